@@ -0,0 +1,42 @@
+// Package autoload loads the realm(s) named by $ENVY_REALM
+// (separated by commas) into the environment when it's
+// imported, without overriding variables already set:
+//
+//	import _ "github.com/matt4biz/envy/autoload"
+//
+// A failure is reported on stderr, but doesn't stop the
+// program; use envy.Load directly to handle it.
+package autoload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/matt4biz/envy"
+)
+
+func init() {
+	realms := splitRealms(os.Getenv(envy.RealmEnv))
+
+	if len(realms) == 0 {
+		return
+	}
+
+	if err := envy.Load(realms...); err != nil {
+		fmt.Fprintf(os.Stderr, "envy: loading %s: %s\n", strings.Join(realms, ","), err)
+	}
+}
+
+// splitRealms splits a list of realms, dropping empty names.
+func splitRealms(s string) []string {
+	var result []string
+
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,23 @@
+package autoload
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRealms(t *testing.T) {
+	table := []struct {
+		in  string
+		exp []string
+	}{
+		{"", nil},
+		{"dev", []string{"dev"}},
+		{" dev, ,base ", []string{"dev", "base"}},
+	}
+
+	for _, tt := range table {
+		if got := splitRealms(tt.in); !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%q: got %v", tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package envy
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Backup writes all the realms, with their values and metadata,
+// to a single file encrypted under a key derived from the
+// passphrase, so that it may be restored anywhere (it doesn't
+// depend on the secret key in the keychain). Every protected
+// realm must be unlocked first, as its values are revealed to
+// anyone with the passphrase; its policy goes with it.
+func (e *Envy) Backup(w io.Writer, passphrase []byte) error {
+	realms, err := e.Realms()
+
+	if err != nil {
+		return err
+	}
+
+	a := internal.NewArchive()
+	a.Created = time.Now().Unix()
+
+	for _, r := range realms {
+		if err = e.checkReveal(r); err != nil {
+			return err
+		}
+
+		m, err := e.fetchRaw(r)
+
+		if err != nil {
+			return err
+		}
+
+		a.Realms[r] = m
+
+		if rr, err := e.realmKey(r); err != nil {
+			return err
+		} else if rr != nil && rr.Policy != nil {
+			a.Policies[r] = rr.Policy
+		}
+
+		if err = e.audit("backup", r); err != nil {
+			return err
+		}
+	}
+
+	return a.WriteBackup(w, passphrase)
+}
+
+// RestoreOptions control how a backup is restored.
+type RestoreOptions struct {
+	Replace bool // drop keys in each restored realm that aren't in the backup
+	DryRun  bool // only report what would change
+}
+
+// Change describes what a restore did (or would do) to a key:
+// "add", "update", "drop", or "same".
+type Change struct {
+	Realm string
+	Key   string
+	Kind  string
+}
+
+// Restore reads a backup and merges it into the store. By default
+// keys not in the backup are left alone; with the Replace option,
+// each realm in the backup replaces the current one, all at once,
+// with its old contents going to the trash (but realms not in the
+// backup are never touched), and a protected realm that would
+// lose keys must be unlocked first. A realm that was protected
+// is protected again as it was, which needs it unlocked if it's
+// protected already with another passphrase.
+func (e *Envy) Restore(r io.Reader, passphrase []byte, opts RestoreOptions) ([]Change, error) {
+	a, err := internal.ReadBackup(r, passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e.restore(a, opts)
+}
+
+func (e *Envy) restore(a *internal.Archive, opts RestoreOptions) ([]Change, error) {
+	changes := make([]Change, 0)
+	realms := make([]string, 0, len(a.Realms))
+
+	for r := range a.Realms {
+		realms = append(realms, r)
+	}
+
+	sort.Strings(realms)
+
+	for _, r := range realms {
+		current, err := e.fetchRaw(r)
+
+		if errors.Is(err, internal.ErrNotFound) {
+			current = make(internal.Loaded) // a new realm
+		} else if err != nil {
+			return nil, err
+		}
+
+		restored := a.Realms[r]
+		m := make(internal.Stored, len(restored))
+		keys := make([]string, 0, len(restored))
+
+		for k := range restored {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		s := e.sealer
+		same := make(map[string]bool)
+
+		if !opts.DryRun {
+			if s, err = e.realmSealer(r, true); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, k := range keys {
+			ud := restored[k]
+			kind := "add"
+
+			if cur, ok := current[k]; ok {
+				kind = "update"
+
+				if cur.Data == ud.Data && cur.Meta == ud.Meta {
+					kind = "same"
+				}
+			}
+
+			changes = append(changes, Change{r, k, kind})
+
+			// a replaced realm keeps what's the same, too
+
+			if opts.DryRun || kind == "same" && !opts.Replace {
+				continue
+			} else if kind == "same" {
+				same[k] = true
+			}
+
+			// sealing keeps the original timestamp & expiry
+
+			if m[k], err = s.SealFor(r, k, ud); err != nil {
+				return nil, err
+			}
+		}
+
+		dropped := make([]string, 0)
+
+		if opts.Replace {
+			for k := range current {
+				if _, ok := restored[k]; !ok {
+					dropped = append(dropped, k)
+				}
+			}
+
+			sort.Strings(dropped)
+
+			for _, k := range dropped {
+				changes = append(changes, Change{r, k, "drop"})
+			}
+
+			if len(dropped) > 0 && !opts.DryRun {
+				if err = e.checkReveal(r); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		if p := a.Policies[r]; p != nil {
+			if err = e.restorePolicy(r, p); err != nil {
+				return nil, err
+			}
+		}
+
+		// the realm's replaced all at once, its old contents
+		// going to the trash, only if there's anything to drop
+
+		replace := len(dropped) > 0
+
+		if !replace {
+			for k := range same {
+				delete(m, k)
+			}
+		}
+
+		if len(m) > 0 || replace {
+			if _, err = e.setKeys(r, m, replace); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = e.audit("restore", r); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// restorePolicy protects the realm as it was when backed up;
+// if it's protected already with another passphrase, it must
+// be unlocked, so that it can't be taken over by a backup.
+func (e *Envy) restorePolicy(realm string, p *internal.Protection) error {
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return err
+	}
+
+	if rr != nil && rr.Policy != nil {
+		if reflect.DeepEqual(rr.Policy, p) {
+			return nil
+		}
+
+		if err = e.checkReveal(realm); err != nil {
+			return err
+		}
+	}
+
+	return e.setPolicy(realm, p)
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"time"
 
+	"github.com/matt4biz/envy"
 	"github.com/matt4biz/envy/internal"
 )
 
@@ -11,7 +15,39 @@ type AddCommand struct {
 }
 
 func (cmd *AddCommand) Run() int {
-	e, err := internal.NewExtractor(cmd.args)
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	expires := fs.String("expires", "", "expiry date")
+	maxAge := fs.String("max-age", "", "rotation period")
+	typ := fs.String("type", "", "value type; binary & file values are read from files")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	var (
+		t   time.Time
+		d   time.Duration
+		err error
+	)
+
+	if *expires != "" {
+		if t, err = internal.ParseTime(*expires); err != nil {
+			fmt.Fprintf(cmd.stderr, "expires: %s\n", err)
+			return -1
+		}
+	}
+
+	if *maxAge != "" {
+		if d, err = internal.ParseDuration(*maxAge); err != nil {
+			fmt.Fprintf(cmd.stderr, "max-age: %s\n", err)
+			return -1
+		}
+	}
+
+	e, err := internal.NewExtractor(fs.Args())
 
 	if err != nil {
 		fmt.Fprintf(cmd.stderr, "extract: %s\n", err)
@@ -20,10 +56,44 @@ func (cmd *AddCommand) Run() int {
 
 	cmd.args = e.Args()
 
-	if err = cmd.Add(e.Realm(), e.Values()); err != nil {
+	vals, err := typedValues(e.Values(), *typ)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "add: %s\n", err)
+		return -1
+	}
+
+	opts := envy.AddOptions{Expires: t, MaxAge: d}
+
+	if err = cmd.AddValuesWith(e.Realm(), vals, opts); err != nil {
 		fmt.Fprintln(cmd.stderr, err)
 		return -1
 	}
 
 	return 0
 }
+
+// typedValues gives all the values a type; for binary and
+// file values, each value is the name of a file to read.
+func typedValues(m map[string]string, typ string) (map[string]envy.Value, error) {
+	result := make(map[string]envy.Value, len(m))
+
+	for k, v := range m {
+		if typ != envy.TypeBinary && typ != envy.TypeFile {
+			result[k] = envy.Value{Data: v, Type: typ}
+			continue
+		}
+
+		b, err := ioutil.ReadFile(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bv := envy.BinaryValue(b)
+		bv.Type = typ
+		result[k] = bv
+	}
+
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type AgentCommand struct {
+	*App
+}
+
+// NeedsDB is false because the agent only holds the key;
+// commands using it still open the DB themselves.
+func (cmd *AgentCommand) NeedsDB() bool {
+	return false
+}
+
+func (cmd *AgentCommand) Run() int {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	timeout := fs.Duration("t", 15*time.Minute, "idle timeout")
+	sock := fs.String("s", "", "socket path")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	fpath := *sock
+
+	if fpath == "" {
+		var err error
+
+		if fpath, err = internal.AgentSocketPath(); err != nil {
+			fmt.Fprintf(cmd.stderr, "agent: %s\n", err)
+			return -1
+		}
+	}
+
+	r, err := internal.NewKeychain()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "agent: %s\n", err)
+		return -1
+	}
+
+	a := internal.NewAgent(r, *timeout)
+	l, err := a.Listen(fpath)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "agent: %s\n", err)
+		return -1
+	}
+
+	defer os.Remove(fpath)
+
+	done := make(chan os.Signal, 1)
+
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-done
+		l.Close()
+	}()
+
+	fmt.Fprintf(cmd.stdout, "ENVY_AGENT_SOCK=%s; export ENVY_AGENT_SOCK;\n", fpath)
+
+	_ = a.Serve(l)
+	return 0
+}
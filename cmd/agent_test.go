@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAgentBadFlag(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	app.args = []string{"-t", "never"}
+
+	cmd := AgentCommand{app}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return: %d", o)
+	}
+}
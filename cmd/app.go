@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/matt4biz/envy"
 )
@@ -13,6 +18,7 @@ import (
 type App struct {
 	*envy.Envy
 
+	ctx     context.Context // cancelled by an interrupt
 	args    []string
 	version string
 	stdin   io.Reader
@@ -36,6 +42,21 @@ func (a *App) NeedsDB() bool {
 	return true
 }
 
+// confirm asks a yes/no question on stderr, reading the
+// answer from stdin; anything but "y" or "yes" is a no.
+func (a *App) confirm(question string) bool {
+	fmt.Fprintf(a.stderr, "%s [y/N] ", question)
+
+	if a.stdin == nil {
+		return false
+	}
+
+	answer, _ := bufio.NewReader(a.stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
 func (a *App) fromArgs(args []string) error {
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	help := fs.Bool("h", false, "")
@@ -64,18 +85,68 @@ func (a *App) getCommand() (Command, error) {
 	switch s {
 	case "add":
 		return &AddCommand{a}, nil
+	case "agent":
+		return &AgentCommand{a}, nil
+	case "audit":
+		return &AuditCommand{a}, nil
+	case "backup":
+		return &BackupCommand{a}, nil
+	case "doctor":
+		return &DoctorCommand{a}, nil
 	case "drop":
 		return &DropCommand{a}, nil
 	case "exec":
 		return &ExecCommand{a}, nil
+	case "expiring":
+		return &ExpiringCommand{a}, nil
 	case "get":
 		return &GetCommand{a}, nil
+	case "hide-names":
+		return &HideNamesCommand{a}, nil
+	case "inspect":
+		return &InspectCommand{a}, nil
 	case "list":
 		return &ListCommand{a}, nil
+	case "lock":
+		return &LockCommand{a}, nil
+	case "merge-file":
+		return &MergeFileCommand{a}, nil
+	case "open-file":
+		return &OpenFileCommand{a}, nil
+	case "otp":
+		return &OTPCommand{a}, nil
+	case "protect":
+		return &ProtectCommand{a}, nil
+	case "pubkey":
+		return &PubkeyCommand{a}, nil
 	case "read":
 		return &ReadCommand{a}, nil
+	case "receive":
+		return &ReceiveCommand{a}, nil
+	case "render":
+		return &RenderCommand{a}, nil
+	case "restore":
+		return &RestoreCommand{a}, nil
+	case "restore-trash":
+		return &RestoreTrashCommand{a}, nil
+	case "rotate-key":
+		return &RotateKeyCommand{a}, nil
+	case "seal-file":
+		return &SealFileCommand{a}, nil
+	case "serve":
+		return &ServeCommand{a}, nil
+	case "share":
+		return &ShareCommand{a}, nil
+	case "trash":
+		return &TrashCommand{a}, nil
+	case "unlock":
+		return &UnlockCommand{a}, nil
+	case "unprotect":
+		return &UnprotectCommand{a}, nil
 	case "version":
 		return &VersionCommand{a}, nil
+	case "watch":
+		return &WatchCommand{a}, nil
 	case "write":
 		return &WriteCommand{a}, nil
 	}
@@ -89,39 +160,145 @@ envy: a tool to securely store and retrieve environment variables.
 
 Variables are key-value pairs stored in a "realm" (or "namespace") of which 
 there may be one or more. All data is stored in a DB within the user's "config" 
-directory, encrypted with a per-user secret key stored in the system keychain.
+directory, encrypted with a per-realm data key, which in turn is encrypted with
+a per-user secret key stored in the system keychain. Rotate-key replaces the
+data key for one or more realms, resealing their values. Hide-names encrypts
+the realm and key names in the DB as well (this can't be undone). Protect sets
+a passphrase for a realm, which must then be given before its values are shown
+(or set $ENVY_REALM_PASSPHRASE), as it must be to back it up; dropping,
+clearing or replacing it asks to confirm.
 
 All operations take place in one of the subcommands. Add will create a realm
 if it doesn't exist, or overwrite keys in a realm that already exists. Drop
-may be used to delete one key or an entire realm. Exec will execute a command
+may be used to delete one key or an entire realm, which go to the trash for 30
+days; restore-trash puts back the latest one dropped by that name. Exec will execute a command
 with arguments, with value(s) from the realm injected as environment variables.
 Get will return the stored value (string for a key, JSON for an entire realm).
+Template values may refer to others as ${KEY} or ${realm/KEY} (with $${ for a
+literal ${), which are resolved by get, exec, and the like.
 Read and write allow a realm's data to be exported or imported in JSON format.
+Agent uses the secret key for other commands over a socket; lock wipes it
+(and stops the agent using it) until unlock.
+Every access to the store is recorded in an audit log, which audit displays.
+Backup and restore save or load all realms in a file encrypted by passphrase.
+Share and receive pass a realm to others, encrypted to their public keys.
+Seal-file writes a dotenv file for git with the keys readable but the values
+encrypted to public keys; open-file decrypts it (and merge-file merges it).
+Doctor checks the keyring, file permissions, and that every record is readable.
+Serve provides a local HTTP API (also in Vault KV v2 form) for other programs.
 
 Usage: envy [opts] subcommand
   -h  show this help message and exit
 
-  add          realm       key=value [key=value ...]
-  get          realm[/key]
+  add   [opts] realm       key=value [key=value ...]
+    -expires  date (or RFC 3339 time) when the value(s) expire
+    -max-age  period (e.g., 90d) after which the value(s) expire
+    -type     string, number, bool, json, template, totp, binary or file
+              (the last two read from the file named by each value)
+  audit [opts]
+    -realm, -key, -op  show only entries for a realm, key, or operation
+    -since   show only entries since a date or for a period (e.g., 7d)
+    -verify  check the log hasn't been tampered with
+  agent [opts]
+    -t  idle timeout before the key is wiped (default 15m)
+    -s  socket path (default $ENVY_AGENT_SOCK or config-dir/envy/agent.sock)
+  get   [opts] realm[/key]
     -n	don't add a trailing newline
-  drop         realm[/key]
-  exec         realm[/key] command [args ...]
+    -u  show references in values (${KEY}, ${realm/KEY}) unresolved
+    -expired  ignore, warn (default), or refuse expired values
+  doctor [opts]
+    -quarantine  move unreadable records aside
+    -yes         don't ask for confirmation
+  drop  [opts] realm[/key]
+    -yes  don't ask for confirmation (for a protected realm)
+  trash list
+  trash empty [opts]
+    -yes  don't ask for confirmation
+  restore-trash realm[/key]
+  exec  [opts] realm[/key] command [args ...]
+    -expired  ignore, warn (default), or refuse expired values
+    -restart-on-change  restart the command when values change
+    -signal    signal to stop it with (default TERM)
+    -grace     time it has to stop, before it's killed (default 10s)
+    -interval  how often to check for changes (default 2s)
+  expiring [opts] [realm ...]
+    -within  period (default 14d); exits 1 if any keys expire by then
+  hide-names [opts]
+    -yes  don't ask for confirmation
+  inspect      realm/key
+  otp   [opts] realm/key   print a TOTP value's current code
+    -q  print only the code, not the seconds left
   list  [opts] [realm[/key]]
     -d  show decrypted secrets also
+    -x  show the expiry, subject & issuer of JWTs and certificates
+  lock
+  unlock
   read  [opts] realm       file ('-' for stdout)
-    -q  unquote embedded JSON in values
+    -q     unquote embedded JSON in values
+    -nest  nest keys split on dot, env (DB__HOST) or a separator
+    -yaml  write YAML (also for a .yaml or .yml file)
   write [opts] realm       file ('-' for stdin)
     -clear  overwrite contents
+    -yes    don't ask for confirmation (for a protected realm)
+    -flatten  flatten nested keys with dot, env (DB__HOST) or a separator
+    -yaml     read YAML (also for a .yaml or .yml file)
+  render [opts] template
+    -realm     realm whose values are the template's data
+    -o         output file, written 0600 (default stdout)
+    -watch     render again when values change (needs -o)
+    -interval  how often to check for changes (default 2s)
+  watch [opts] realm [realm ...]
+    -interval  how often to check for changes (default 2s)
+    -hook      shell command to run for each change, with
+               $ENVY_CHANGE_REALM, _KEY and _KIND set
+  backup  [opts] file ('-' for stdout)
+  restore [opts] file ('-' for stdin)
+    -passphrase-file  read the passphrase from a file (or set $ENVY_PASSPHRASE)
+    -replace  drop keys in restored realms that aren't in the backup
+    -n        only show what would change
+    -yes      don't ask for confirmation (for a protected realm)
+  pubkey
+  share   realm [opts] > file
+    -to    recipient's public key, or a file with it (may be repeated)
+    -self  also share with yourself
+  receive [opts] file ('-' for stdin)
+    -realm    import under another realm name
+    -replace  drop keys in the realm that aren't in the file
+    -n        only show what would change
+    -yes      don't ask for confirmation (for a realm that exists)
+  rotate-key [opts] [realm ...]
+    -all  every realm, after which records in the old format are refused
+  protect [opts] realm
+    -passphrase-file  read the new passphrase from a file
+  unprotect realm
+  seal-file [opts] [file ('-' for stdin)]
+    -realm   seal a realm rather than a dotenv file
+    -o       output file, which is resealed if it exists (default stdout)
+    -to      recipient's public key, or a file with it (may be repeated)
+    -rotate  use a new data key, sealed only to yourself and the -to keys
+  open-file [opts] file ('-' for stdin)
+    -realm     add the values to a realm rather than print them
+    -textconv  for git diff; shows ciphertexts if you're not a recipient
+  merge-file base ours theirs
+  serve [opts]
+    -addr    loopback address or unix:path (default 127.0.0.1:8200)
+    -tokens  JSON file of [{"name", "token", "realms": [...]}] (required)
   version
 
-Listing a realm displays a timestamp, size, and hash for each key-value pair.
+Listing a realm displays a timestamp, size, and hash for each key-value pair,
+and the days left for those that expire. Inspect decodes a JWT or certificate,
+with any signature redacted. In a realm with OAUTH_TOKEN_URL and
+OAUTH_REFRESH_TOKEN, get and exec refresh OAUTH_ACCESS_TOKEN once it expires.
 	`)
 
 	fmt.Fprintln(a.stderr, msg)
 }
 
 func runApp(args []string, version string, stdin io.Reader, stdout, stderr io.Writer) int {
-	a := App{version: version, stdin: stdin, stdout: stdout, stderr: stderr}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	a := App{ctx: ctx, version: version, stdin: stdin, stdout: stdout, stderr: stderr}
 
 	if err := a.fromArgs(args); err != nil {
 		if err == ErrUsage {
@@ -140,7 +317,7 @@ func runApp(args []string, version string, stdin io.Reader, stdout, stderr io.Wr
 	}
 
 	if cmd.NeedsDB() {
-		a.Envy, err = envy.New()
+		a.Envy, err = envy.OpenContext(ctx, "")
 
 		if err != nil {
 			fmt.Fprintln(stderr, err)
@@ -152,3 +329,27 @@ func runApp(args []string, version string, stdin io.Reader, stdout, stderr io.Wr
 
 	return cmd.Run()
 }
+
+// signalContext returns a context that's cancelled by an
+// interrupt or SIGTERM, so that a command waiting for the DB
+// (or anything else that takes the context) stops cleanly; after
+// that, signals aren't caught, so a second one stops a command
+// that's not waiting on the context (unless it catches them).
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+
+		signal.Stop(sig)
+	}()
+
+	return ctx, cancel
+}
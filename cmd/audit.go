@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type AuditCommand struct {
+	*App
+}
+
+func (cmd *AuditCommand) Run() int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	realm := fs.String("realm", "", "only this realm")
+	key := fs.String("key", "", "only this key")
+	op := fs.String("op", "", "only this operation")
+	since := fs.String("since", "", "only entries since a date or for a period (e.g., 7d)")
+	verify := fs.Bool("verify", false, "verify the log")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	if *verify {
+		if err := cmd.VerifyAudit(); err != nil {
+			fmt.Fprintf(cmd.stderr, "audit: %s\n", err)
+			return 1
+		}
+
+		fmt.Fprintln(cmd.stdout, "audit log verified")
+		return 0
+	}
+
+	var from time.Time
+
+	if *since != "" {
+		var err error
+
+		if from, err = internal.ParseTime(*since); err != nil {
+			d, err := internal.ParseDuration(*since)
+
+			if err != nil {
+				fmt.Fprintf(cmd.stderr, "audit: invalid -since %q\n", *since)
+				return -1
+			}
+
+			from = time.Now().Add(-d)
+		}
+	}
+
+	entries, err := cmd.Audit()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "audit: %s\n", err)
+		return -1
+	}
+
+	for _, a := range entries {
+		if (*realm != "" && a.Realm != *realm) || (*key != "" && a.Key != *key) || (*op != "" && a.Op != *op) {
+			continue
+		}
+
+		if !from.IsZero() && a.Time < from.UnixNano() {
+			continue
+		}
+
+		fmt.Fprintln(cmd.stdout, a)
+	}
+
+	return 0
+}
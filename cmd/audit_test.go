@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if _, err := app.Get("top", "a"); err != nil {
+		t.Fatal("get", err)
+	}
+
+	if err := app.Drop("top", "b"); err != nil {
+		t.Fatal("drop", err)
+	}
+
+	cmd := AuditCommand{app}
+
+	app.args = []string{"-realm", "top", "-since", "1h"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid 1st return: %d", o)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+
+	if len(lines) != 4 || !strings.Contains(lines[0], "add    top/a") || !strings.Contains(lines[3], "drop   top/b") {
+		t.Errorf("invalid log: %q", lines)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-op", "get"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Fatalf("invalid 2nd return: %d", o)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 1 {
+		t.Errorf("invalid filtered log: %q", lines)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-verify"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid verify return: %d", o)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type BackupCommand struct {
+	*App
+}
+
+func (cmd *BackupCommand) Run() int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	pfile := fs.String("passphrase-file", "", "read the passphrase from a file")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	cmd.args = fs.Args()
+
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	// protected realms are revealed to anyone with the backup
+	// passphrase, so they need their own passphrases first
+
+	realms, err := cmd.Realms()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "backup: %s\n", err)
+		return -1
+	}
+
+	for _, r := range realms {
+		if err = cmd.unlock(r); err != nil {
+			fmt.Fprintf(cmd.stderr, "backup: %s\n", err)
+			return -1
+		}
+	}
+
+	p, err := cmd.readPassphrase("backup passphrase", *pfile, passphraseEnv, true)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "backup: %s\n", err)
+		return -1
+	}
+
+	writer := cmd.stdout
+
+	if cmd.args[0] != "-" {
+		file, err := os.OpenFile(cmd.args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+		if err != nil {
+			fmt.Fprintf(cmd.stderr, "backup: %s\n", err)
+			return -1
+		}
+
+		defer file.Close()
+
+		writer = file
+	}
+
+	if err = cmd.Backup(writer, p); err != nil {
+		fmt.Fprintf(cmd.stderr, "backup: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	os.Setenv("ENVY_PASSPHRASE", "sekrit")
+	defer os.Unsetenv("ENVY_PASSPHRASE")
+
+	fname := path.Join(dname, "envy.backup")
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err := app.Add("other", map[string]string{"c": "ZZ"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err := app.SetExpiry("top", "a", time.Time{}, 90*24*time.Hour); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{fname}
+
+	backup := BackupCommand{app}
+
+	if o := backup.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid backup return: %d", o)
+	}
+
+	if fi, err := os.Stat(fname); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("invalid backup file: %v %v", fi, err)
+	}
+
+	// restore into a new, different store
+
+	app2 := NewTestApp(t, stdout, stderr)
+
+	if err := app2.Add("top", map[string]string{"a": "QQ", "d": "WW"}); err != nil {
+		t.Fatal("setup 2", err)
+	}
+
+	restore := RestoreCommand{app2}
+
+	app2.args = []string{"-n", "-replace", fname}
+
+	if o := restore.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid dry-run return: %d", o)
+	}
+
+	exp := "+ other/c\n~ top/a\n+ top/b\n- top/d\n"
+
+	if s := stdout.String(); s != exp {
+		t.Errorf("invalid dry-run output: %q", s)
+	}
+
+	if m, err := app2.Fetch("top"); err != nil || m["a"] != "QQ" {
+		t.Errorf("dry run made changes: %v %v", m, err)
+	}
+
+	stdout.Reset()
+	app2.args = []string{fname}
+
+	if o := restore.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid merge return: %d", o)
+	}
+
+	m, err := app2.Fetch("top")
+
+	if err != nil || len(m) != 3 || m["a"] != "XX" || m["d"] != "WW" {
+		t.Errorf("invalid merge: %v %v", m, err)
+	}
+
+	if xl, err := app2.Expiring(100*24*time.Hour, "top"); err != nil || len(xl) != 1 || xl[0].Key != "a" {
+		t.Errorf("expiry not restored: %v %v", xl, err)
+	}
+
+	app2.args = []string{"-replace", fname}
+
+	if o := restore.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid replace return: %d", o)
+	}
+
+	if m, err := app2.Fetch("top"); err != nil || len(m) != 2 {
+		t.Errorf("invalid replace: %v %v", m, err)
+	}
+
+	os.Setenv("ENVY_PASSPHRASE", "wrong")
+	stderr.Reset()
+
+	if o := restore.Run(); o != -1 || !strings.Contains(stderr.String(), "wrong passphrase") {
+		t.Errorf("invalid wrong passphrase: %d %s", o, stderr.String())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+type DoctorCommand struct {
+	*App
+}
+
+// NeedsDB is false so that we can report on the keyring
+// and permissions even if the DB can't be opened.
+func (cmd *DoctorCommand) NeedsDB() bool {
+	return false
+}
+
+func (cmd *DoctorCommand) Run() int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	quarantine := fs.Bool("quarantine", false, "move unreadable records aside")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	failed := false
+
+	report := func(what string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(cmd.stdout, "FAIL  %s: %s\n", what, err)
+		} else {
+			fmt.Fprintf(cmd.stdout, "ok    %s\n", what)
+		}
+	}
+
+	s, err := internal.NewDefaultSealer()
+
+	report("keyring access", err)
+
+	if err != nil {
+		return 1
+	}
+
+	if cmd.Envy == nil {
+		dir, err := envy.DefaultDirectory()
+
+		if err != nil {
+			report("config directory", err)
+			return 1
+		}
+
+		if cmd.Envy, err = envy.NewWithSealer(dir, s); err != nil {
+			report("open database", err)
+			return 1
+		}
+
+		defer cmd.Envy.Close()
+	}
+
+	perms := envy.CheckPermissions(cmd.Directory())
+
+	for _, p := range perms {
+		report("permissions", p.Err)
+	}
+
+	if len(perms) == 0 {
+		report("permissions", nil)
+	}
+
+	problems, err := cmd.Check()
+
+	if err != nil {
+		report("check", err)
+		return 1
+	}
+
+	bad := make([]envy.Problem, 0, len(problems))
+	wrongKey := false
+
+	for _, p := range problems {
+		failed = true
+		fmt.Fprintf(cmd.stdout, "FAIL  %s\n", p)
+
+		if p.Unreadable() {
+			bad = append(bad, p)
+		} else if errors.Is(p.Err, envy.ErrWrongKey) {
+			wrongKey = true
+		}
+	}
+
+	if len(problems) == 0 {
+		report("database, records, and audit log", nil)
+	}
+
+	// if the key is wrong, every record will look bad, but
+	// quarantining them all won't help
+
+	if len(bad) == 0 || !*quarantine || wrongKey {
+		if failed {
+			return 1
+		}
+
+		return 0
+	}
+
+	if !*yes && !cmd.confirm(fmt.Sprintf("quarantine %d unreadable record(s)?", len(bad))) {
+		return 1
+	}
+
+	for _, p := range bad {
+		if err := cmd.Quarantine(p.Realm, p.Key); err != nil {
+			fmt.Fprintln(cmd.stderr, err)
+			return -1
+		}
+
+		fmt.Fprintf(cmd.stdout, "quarantined %s/%s\n", p.Realm, p.Key)
+	}
+
+	return 1
+}
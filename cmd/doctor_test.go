@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+type otherRing struct{}
+
+func (otherRing) GetSecret() ([]byte, error) {
+	return bytes.Repeat([]byte{7}, 32), nil
+}
+
+func (otherRing) GetUsername() string {
+	return "other-user"
+}
+
+type otherNonce struct{}
+
+func (otherNonce) GetNonce() ([]byte, error) {
+	return bytes.Repeat([]byte{1}, 12), nil
+}
+
+func TestDoctor(t *testing.T) { //nolint:gocyclo
+	keyring.MockInit()
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	e, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	if err = e.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	e.Close()
+
+	// put in one record sealed with a different key, which
+	// we won't be able to read
+
+	other, _ := internal.NewSealer(otherRing{}, otherNonce{})
+	db, err := internal.NewBoltDB(path.Join(dname, "envy.db"))
+
+	if err != nil {
+		t.Fatal("db", err)
+	}
+
+	sd, err := other.Seal(internal.Unsealed{Data: "ZZ"})
+
+	if err != nil {
+		t.Fatal("other seal", err)
+	}
+
+	if err = db.SetKey("top", "bad", sd); err != nil {
+		t.Fatal("other set", err)
+	}
+
+	db.Close()
+
+	if e, err = envy.NewWithSealer(dname, internal.NewTestSealer()); err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer e.Close()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := &App{Envy: e, ctx: context.Background(), stdin: strings.NewReader("y\n"), stdout: stdout, stderr: stderr}
+	cmd := DoctorCommand{app}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("output: %s", stdout.String())
+		t.Fatalf("invalid 1st return: %d", o)
+	}
+
+	t.Log("\n" + stdout.String())
+
+	if s := stdout.String(); !strings.Contains(s, "FAIL  top/bad: unsealing: cipher: message authentication failed") {
+		t.Errorf("invalid 1st output: %s", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-quarantine"}
+
+	if o := cmd.Run(); o != 1 {
+		t.Fatalf("invalid 2nd return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.Contains(s, "quarantined top/bad") {
+		t.Errorf("invalid 2nd output: %s", s)
+	}
+
+	stdout.Reset()
+	app.args = nil
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("output: %s", stdout.String())
+		t.Fatalf("invalid 3rd return: %d", o)
+	}
+
+	if s := stdout.String(); strings.Contains(s, "FAIL") {
+		t.Errorf("invalid 3rd output: %s", s)
+	}
+
+	if m, err := e.Fetch("top"); err != nil || len(m) != 2 {
+		t.Errorf("invalid realm after quarantine: %v %v", m, err)
+	}
+}
+
+func TestDoctorWrongKey(t *testing.T) {
+	keyring.MockInit()
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	e, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	// with just one record, it's still the key that's wrong
+
+	if err = e.Add("top", map[string]string{"a": "XX"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	e.Close()
+
+	other, _ := internal.NewSealer(otherRing{}, otherNonce{})
+
+	if e, err = envy.NewWithSealer(dname, other); err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer e.Close()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := &App{Envy: e, ctx: context.Background(), stdin: strings.NewReader("y\n"), stdout: stdout, stderr: stderr}
+	app.args = []string{"-quarantine"}
+	cmd := DoctorCommand{app}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("output: %s", stdout.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.Contains(s, envy.ErrWrongKey.Error()) || strings.Contains(s, "quarantined") {
+		t.Errorf("invalid output: %s", s)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"strings"
 )
@@ -10,14 +11,38 @@ type DropCommand struct {
 }
 
 func (cmd *DropCommand) Run() int {
-	if len(cmd.args) < 1 {
+	fs := flag.NewFlagSet("drop", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
 		cmd.usage()
 		return 1
 	}
 
-	var err error
+	cmd.args = fs.Args()
+
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
 
 	parts := strings.Split(cmd.args[0], "/")
+	what := "drop " + cmd.args[0]
+
+	if len(parts) == 1 {
+		what = "purge it"
+	}
+
+	ok, err := cmd.confirmDestroy(parts[0], what, *yes)
+
+	if err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	} else if !ok {
+		return 1
+	}
 
 	if len(parts) == 1 {
 		err = cmd.Purge(cmd.args[0])
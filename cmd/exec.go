@@ -1,12 +1,18 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/matt4biz/envy"
 )
 
 type ExecCommand struct {
@@ -14,44 +20,92 @@ type ExecCommand struct {
 }
 
 func (cmd *ExecCommand) Run() int {
-	if len(cmd.args) < 2 {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	expired := fs.String("expired", "warn", "expired values: ignore, warn, or refuse")
+	restart := fs.Bool("restart-on-change", false, "restart the command when any values change")
+	stopWith := fs.String("signal", "TERM", "signal to stop the command with, to restart it")
+	grace := fs.Duration("grace", 10*time.Second, "how long the command has to stop before it's killed")
+	interval := fs.Duration("interval", envy.DefaultWatchInterval, "how often to check for changes")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
 		cmd.usage()
 		return 1
 	}
 
-	var (
-		m    []string
-		k, v string
-		err  error
-	)
+	cmd.args = fs.Args()
+
+	sig, ok := stopSignals[strings.TrimPrefix(strings.ToUpper(*stopWith), "SIG")]
+
+	if len(cmd.args) < 2 || !ok || !expiredPolicies[*expired] {
+		cmd.usage()
+		return 1
+	}
+
+	var realm, key string
 
 	parts := strings.Split(cmd.args[0], "/")
+	realm = parts[0]
 
-	if len(parts) == 1 {
-		m, err = cmd.FetchAsVarList(cmd.args[0])
-	} else {
-		k = parts[1]
-		v, err = cmd.Get(parts[0], parts[1])
+	if len(parts) > 1 {
+		key = parts[1]
 	}
 
-	if err != nil {
+	if !cmd.checkExpired(*expired, realm, key) {
+		return -1
+	}
+
+	if err := cmd.unlock(realm); err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	if err := cmd.refresh(realm, key); err != nil {
 		fmt.Fprintln(cmd.stderr, err)
 		return -1
 	}
 
-	if v != "" {
-		m = append(m, k+"="+v)
+	var (
+		ch  <-chan envy.Event
+		err error
+	)
+
+	// the watch must start before the values are read, so
+	// as not to miss a change in between
+
+	if *restart {
+		if ch, err = cmd.WatchWith(cmd.ctx, envy.WatchOptions{Interval: *interval}, realm); err != nil {
+			fmt.Fprintln(cmd.stderr, err)
+			return -1
+		}
+	}
+
+	m, cleanup, err := cmd.environ(realm, key)
+
+	defer func() { cleanup() }()
+
+	if err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
 	}
 
 	done := make(chan os.Signal, 1)
-	sub := exec.Command(cmd.args[1], cmd.args[2:]...)
 
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(done)
 
-	sub.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	sub.Stdout = cmd.stdout
-	sub.Stderr = cmd.stderr
-	sub.Env = append(os.Environ(), m...)
+	if *restart {
+		r := restarter{ExecCommand: cmd, realm: realm, key: key, signal: sig, grace: *grace}
+		return r.run(m, &cleanup, ch, done)
+	}
+
+	sub, exited, err := cmd.start(m)
+
+	if err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
 
 	go func() {
 		s := <-done
@@ -65,14 +119,268 @@ func (cmd *ExecCommand) Run() int {
 		}
 	}()
 
+	if err := <-exited; err != nil {
+		fmt.Fprintln(cmd.stderr, "can't wait", err)
+	}
+
+	return sub.ProcessState.ExitCode()
+}
+
+// stopSignals are those -signal may name.
+var stopSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"KILL": syscall.SIGKILL,
+}
+
+// environ gets the values of the realm (or just the key, if
+// given) as environment variables; see envList.
+func (cmd *ExecCommand) environ(realm, key string) ([]string, func(), error) {
+	var (
+		vals map[string]envy.Value
+		err  error
+	)
+
+	if key == "" {
+		vals, err = cmd.FetchWithContext(cmd.ctx, realm, envy.FetchOptions{})
+	} else {
+		var v envy.Value
+
+		if v, err = cmd.GetWithContext(cmd.ctx, realm, key, envy.FetchOptions{}); err == nil && v.Data != "" {
+			vals = map[string]envy.Value{key: v}
+		}
+	}
+
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	return envList(vals)
+}
+
+// start runs the command with the variables added to our
+// environment; the channel gets the result of waiting for it.
+func (cmd *ExecCommand) start(env []string) (*exec.Cmd, <-chan error, error) {
+	sub := exec.Command(cmd.args[1], cmd.args[2:]...)
+
+	sub.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	sub.Stdout = cmd.stdout
+	sub.Stderr = cmd.stderr
+	sub.Env = append(os.Environ(), env...)
+
 	if err := sub.Start(); err != nil {
-		fmt.Fprintln(cmd.stderr, err)
+		return nil, nil, err
+	}
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- sub.Wait()
+	}()
+
+	return sub, exited, nil
+}
+
+// restartDelay lets a batch of changes (e.g., from one add)
+// settle, so that the command is only restarted once.
+const restartDelay = 250 * time.Millisecond
+
+// restarter runs a command again, with new values, whenever
+// values in the realm change (or just the key, if given).
+type restarter struct {
+	*ExecCommand
+
+	realm  string
+	key    string
+	signal syscall.Signal
+	grace  time.Duration
+}
+
+// run returns the command's exit code once it stops by itself
+// (or by a signal passed on to it); the DB is suspended while it
+// runs, so that the values may be changed meanwhile.
+func (r *restarter) run(env []string, cleanup *func(), ch <-chan envy.Event, done <-chan os.Signal) int {
+	if err := r.Suspend(); err != nil {
+		fmt.Fprintln(r.stderr, err)
 		return -1
 	}
 
-	if err := sub.Wait(); err != nil {
-		fmt.Fprintln(cmd.stderr, "can't wait", err)
+	sub, exited, err := r.start(env)
+
+	if err != nil {
+		fmt.Fprintln(r.stderr, err)
+		return -1
 	}
 
-	return sub.ProcessState.ExitCode()
+	for {
+		select {
+		case <-exited:
+			return sub.ProcessState.ExitCode()
+
+		case s := <-done:
+			if err := sub.Process.Signal(s); err != nil {
+				fmt.Fprintln(r.stderr, "can't send signal", s)
+			}
+
+		case ev, ok := <-ch:
+			if !ok {
+				ch = nil // cancelled; wait for the command
+				continue
+			}
+
+			if !r.affects(ev) || !r.settle(ch) {
+				continue
+			}
+
+			env, next, err := r.reload()
+
+			if err != nil {
+				fmt.Fprintf(r.stderr, "exec: not restarting: %s\n", err)
+				continue
+			}
+
+			fmt.Fprintf(r.stderr, "exec: values changed, restarting %s\n", r.args[1])
+
+			r.stop(sub, exited)
+			(*cleanup)()
+			*cleanup = next
+
+			if sub, exited, err = r.start(env); err != nil {
+				fmt.Fprintln(r.stderr, err)
+				return -1
+			}
+		}
+	}
+}
+
+// affects reports whether a change needs a restart; a token
+// that's been refreshed doesn't, since the old one's still good
+// (and the command would otherwise restart after each refresh).
+func (r *restarter) affects(ev envy.Event) bool {
+	return (r.key == "" || ev.Key == r.key) && !envy.IsOAuthKey(ev.Key)
+}
+
+// settle takes any more changes that come along soon after
+// the first, returning false if the watch has ended.
+func (r *restarter) settle(ch <-chan envy.Event) bool {
+	timer := time.NewTimer(restartDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return false
+			}
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// reload reads the values again, with the DB suspended after.
+func (r *restarter) reload() ([]string, func(), error) {
+	if err := r.ResumeContext(r.ctx); err != nil {
+		return nil, nil, err
+	}
+
+	err := r.refresh(r.realm, r.key)
+
+	var (
+		env     []string
+		cleanup = func() {}
+	)
+
+	if err == nil {
+		env, cleanup, err = r.environ(r.realm, r.key)
+	}
+
+	if serr := r.Suspend(); serr != nil && err == nil {
+		err = serr
+	}
+
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return env, cleanup, nil
+}
+
+// stop signals the command, and kills it (and anything it
+// started) if it hasn't stopped by the end of the grace period.
+func (r *restarter) stop(sub *exec.Cmd, exited <-chan error) {
+	if err := sub.Process.Signal(r.signal); err != nil {
+		fmt.Fprintln(r.stderr, "can't send signal", r.signal)
+	}
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(r.grace):
+	}
+
+	fmt.Fprintf(r.stderr, "exec: %s didn't stop, killing it\n", r.args[1])
+
+	_ = syscall.Kill(-sub.Process.Pid, syscall.SIGKILL)
+	<-exited
+}
+
+// envList makes environment variables of the values; each file
+// value is written to a private temporary file, whose path is
+// passed instead, and which cleanup removes; for a TOTP value,
+// the current code is passed instead of the seed.
+func envList(vals map[string]envy.Value) ([]string, func(), error) {
+	var dir string
+
+	result := make([]string, 0, len(vals))
+	cleanup := func() {
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+	}
+
+	for k, v := range vals {
+		if v.Type == envy.TypeTOTP {
+			code, _, err := v.Code(time.Now())
+
+			if err != nil {
+				return nil, cleanup, err
+			}
+
+			result = append(result, k+"="+code)
+			continue
+		}
+
+		if v.Type != envy.TypeFile {
+			result = append(result, k+"="+v.Data)
+			continue
+		}
+
+		b, err := v.Bytes()
+
+		if err != nil {
+			return nil, cleanup, err
+		}
+
+		if dir == "" {
+			if dir, err = ioutil.TempDir("", "envy"); err != nil {
+				return nil, cleanup, err
+			}
+		}
+
+		fpath := filepath.Join(dir, k)
+
+		if err = ioutil.WriteFile(fpath, b, 0600); err != nil {
+			return nil, cleanup, err
+		}
+
+		result = append(result, k+"="+fpath)
+	}
+
+	return result, cleanup, nil
 }
@@ -2,8 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
 )
 
 func TestExec(t *testing.T) {
@@ -77,3 +88,137 @@ func TestExecOne(t *testing.T) {
 		t.Fatalf("invalid 2nd output: %q", lines)
 	}
 }
+
+func TestExecFile(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	fpath := filepath.Join(dname, "ks")
+
+	if err = ioutil.WriteFile(fpath, []byte("keystore\x00data"), 0600); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"-type", "file", "top", "KS=" + fpath}
+
+	if o := (&AddCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid add return: %d: %s", o, stderr.String())
+	}
+
+	// the variable names a (temporary) copy of the file
+
+	app.args = []string{"top", "/bin/sh", "-c", `cat "$KS"; test "$KS" != ` + fpath}
+
+	if o := (&ExecCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid exec return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); s != "keystore\x00data" {
+		t.Errorf("invalid output: %q", s)
+	}
+}
+
+func TestExecRestart(t *testing.T) {
+	keyring.MockInit()
+
+	// the DB's suspended while the command runs, so unlike
+	// NewTestApp, we need to keep its directory around
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	e, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer e.Close()
+
+	if err = e.Add("app", map[string]string{"A": "1", "B": "x"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	fname := filepath.Join(dname, "out")
+	script := `echo "$A" >> ` + fname + `; [ "$A" = 2 ] && exit 3; exec sleep 30`
+
+	// the command's output is copied in by another goroutine
+
+	stdout := new(lockedBuffer)
+	stderr := new(lockedBuffer)
+	app := &App{Envy: e, ctx: context.Background(), stdout: stdout, stderr: stderr}
+
+	app.args = []string{"-restart-on-change", "-interval", "10ms", "-grace", "5s", "app", "/bin/sh", "-c", script}
+
+	cmd := ExecCommand{app}
+	result := make(chan int, 1)
+
+	go func() {
+		result <- cmd.Run()
+	}()
+
+	waitFor(t, fname, "1\n")
+
+	e2, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	if err = e2.Set("app", "A", "2"); err != nil {
+		t.Fatal("set", err)
+	}
+
+	e2.Close()
+
+	select {
+	case o := <-result:
+		if o != 3 {
+			t.Errorf("errors: %s", stderr.String())
+			t.Errorf("invalid return: %d", o)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("not restarted")
+	}
+
+	if b, err := ioutil.ReadFile(fname); err != nil || string(b) != "1\n2\n" {
+		t.Errorf("invalid output: %q %v", b, err)
+	}
+
+	if !strings.Contains(stderr.String(), "restarting") {
+		t.Errorf("invalid stderr: %s", stderr.String())
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.Write(b)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.String()
+}
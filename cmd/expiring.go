@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type ExpiringCommand struct {
+	*App
+}
+
+// Run lists keys that have expired or will expire soon,
+// returning 1 if there are any (so it may be used from
+// scripts or cron).
+func (cmd *ExpiringCommand) Run() int {
+	fs := flag.NewFlagSet("expiring", flag.ContinueOnError)
+	within := fs.String("within", "14d", "warning period")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	d, err := internal.ParseDuration(*within)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "expiring: %s\n", err)
+		return -1
+	}
+
+	xl, err := cmd.Expiring(d, fs.Args()...)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "expiring: %s\n", err)
+		return -1
+	}
+
+	for _, x := range xl {
+		fmt.Fprintf(cmd.stdout, "%s/%s   %s  %s\n", x.Realm, x.Key, x.Expires.Format(time.RFC3339), internal.DaysLeft(x.Expires))
+	}
+
+	if len(xl) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// expiredPolicies are the choices for -expired.
+var expiredPolicies = map[string]bool{"ignore": true, "warn": true, "refuse": true}
+
+// checkExpired applies the policy for using expired values,
+// which may be to ignore them, warn, or refuse; it returns
+// false if the command must not go on.
+func (a *App) checkExpired(policy, realm, key string) bool {
+	if policy == "ignore" {
+		return true
+	}
+
+	xl, err := a.Expiring(0, realm)
+
+	if err != nil {
+		// the command itself will report a missing realm
+		return true
+	}
+
+	ok := true
+
+	for _, x := range xl {
+		if key != "" && x.Key != key {
+			continue
+		}
+
+		if policy == "refuse" {
+			fmt.Fprintf(a.stderr, "%s/%s expired at %s\n", x.Realm, x.Key, x.Expires.Format(time.RFC3339))
+			ok = false
+		} else {
+			fmt.Fprintf(a.stderr, "warning: %s/%s expired at %s\n", x.Realm, x.Key, x.Expires.Format(time.RFC3339))
+		}
+	}
+
+	return ok
+}
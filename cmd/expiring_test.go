@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiring(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	app.args = []string{"-max-age", "7d", "top", "a=XX"}
+
+	add := AddCommand{app}
+
+	if o := add.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid add return: %d", o)
+	}
+
+	if err := app.Add("top", map[string]string{"b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	cmd := ExpiringCommand{app}
+
+	app.args = []string{"-within", "3d"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid 1st return: %d", o)
+	}
+
+	app.args = []string{"-within", "2w", "top"}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid 2nd return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.HasPrefix(s, "top/a ") || !strings.Contains(s, "7d left") {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	// the max-age carries over when the value is replaced
+
+	if err := app.Set("top", "a", "ZZ"); err != nil {
+		t.Fatal("set", err)
+	}
+
+	if xl, err := app.Expiring(14*24*time.Hour, "top"); err != nil || len(xl) != 1 {
+		t.Errorf("invalid expiring: %v %v", xl, err)
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("top", map[string]string{"a": "XX"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err := app.SetExpiry("top", "a", time.Now().Add(-time.Hour), 0); err != nil {
+		t.Fatal("expiry", err)
+	}
+
+	cmd := GetCommand{app}
+
+	app.args = []string{"top/a"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Fatalf("invalid warn return: %d", o)
+	}
+
+	if s := stderr.String(); !strings.HasPrefix(s, "warning: top/a expired") {
+		t.Errorf("invalid warning: %q", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-expired", "refuse", "top/a"}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid refuse return: %d", o)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("value was output: %q", stdout.String())
+	}
+
+	// a misspelt policy isn't taken as a warning
+
+	app.args = []string{"-expired", "refsue", "top/a"}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return for unknown policy: %d", o)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("value was output: %q", stdout.String())
+	}
+}
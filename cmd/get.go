@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+
+	"github.com/matt4biz/envy"
 )
 
 type GetCommand struct {
@@ -14,6 +16,8 @@ type GetCommand struct {
 func (cmd *GetCommand) Run() int {
 	fs := flag.NewFlagSet("get", flag.ContinueOnError)
 	raw := fs.Bool("n", false, "remove trailing newline")
+	expired := fs.String("expired", "warn", "expired values: ignore, warn, or refuse")
+	unresolved := fs.Bool("u", false, "show references in values unresolved")
 
 	fs.Usage = cmd.usage
 
@@ -24,7 +28,7 @@ func (cmd *GetCommand) Run() int {
 
 	cmd.args = fs.Args()
 
-	if len(cmd.args) < 1 {
+	if len(cmd.args) < 1 || !expiredPolicies[*expired] {
 		cmd.usage()
 		return 1
 	}
@@ -32,11 +36,32 @@ func (cmd *GetCommand) Run() int {
 	var err error
 
 	parts := strings.Split(cmd.args[0], "/")
+	key := ""
+
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+
+	if !cmd.checkExpired(*expired, parts[0], key) {
+		return -1
+	}
+
+	if err = cmd.unlock(parts[0]); err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	if !*unresolved {
+		if err = cmd.refresh(parts[0], key); err != nil {
+			fmt.Fprintln(cmd.stderr, err)
+			return -1
+		}
+	}
 
 	if len(parts) == 1 {
 		var m json.RawMessage
 
-		if m, err = cmd.FetchAsJSON(cmd.args[0]); err == nil {
+		if m, err = cmd.fetchJSON(cmd.args[0], *unresolved); err == nil {
 			if *raw {
 				fmt.Fprint(cmd.stdout, string(m))
 			} else {
@@ -45,13 +70,19 @@ func (cmd *GetCommand) Run() int {
 
 		}
 	} else {
-		var s string
+		var v envy.Value
 
-		if s, err = cmd.Get(parts[0], parts[1]); err == nil {
-			if *raw {
-				fmt.Fprint(cmd.stdout, s)
-			} else {
-				fmt.Fprintln(cmd.stdout, s)
+		// binary values are written as they are
+
+		if v, err = cmd.GetWithContext(cmd.ctx, parts[0], parts[1], envy.FetchOptions{Unresolved: *unresolved}); err == nil {
+			var b []byte
+
+			if b, err = v.Bytes(); err == nil {
+				_, err = cmd.stdout.Write(b)
+			}
+
+			if err == nil && !*raw && !v.IsBinary() {
+				fmt.Fprintln(cmd.stdout)
 			}
 		}
 	}
@@ -63,3 +94,14 @@ func (cmd *GetCommand) Run() int {
 
 	return 0
 }
+
+// fetchJSON gets a realm as JSON, possibly unresolved.
+func (cmd *GetCommand) fetchJSON(realm string, unresolved bool) (json.RawMessage, error) {
+	m, err := cmd.FetchWithContext(cmd.ctx, realm, envy.FetchOptions{Unresolved: unresolved})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return envy.ValuesAsJSON(m)
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+
+	"github.com/matt4biz/envy"
 )
 
 func TestGet(t *testing.T) {
@@ -89,3 +91,56 @@ func TestGetRaw(t *testing.T) {
 		t.Errorf("wrong data, got %q", s)
 	}
 }
+
+func TestGetBinary(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	blob := []byte{0xff, 0x00, 0xfe, '\n'}
+
+	if err := app.SetValue("top", "blob", envy.BinaryValue(blob)); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"top/blob"}
+
+	if o := (&GetCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid return: %d: %s", o, stderr.String())
+	}
+
+	if !bytes.Equal(stdout.Bytes(), blob) {
+		t.Errorf("invalid output: %q", stdout.String())
+	}
+}
+
+func TestGetReferences(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.AddValues("top", map[string]envy.Value{"a": {Data: "x"}, "b": {Data: "${a}-y", Type: envy.TypeTemplate}}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"top/b"}
+
+	if o := (&GetCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); s != "x-y\n" {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-u", "top"}
+
+	if o := (&GetCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid -u return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); s != `{"a":"x","b":"${a}-y"}`+"\n" {
+		t.Errorf("invalid -u output: %q", s)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+type HideNamesCommand struct {
+	*App
+}
+
+func (cmd *HideNamesCommand) Run() int {
+	fs := flag.NewFlagSet("hide-names", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	if !*yes && !cmd.confirm("hide realm and key names? this can't be undone") {
+		return 1
+	}
+
+	if err := cmd.HideNames(); err != nil {
+		fmt.Fprintf(cmd.stderr, "hide-names: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+func TestHideNames(t *testing.T) {
+	keyring.MockInit()
+
+	// the DB's rewritten, so unlike NewTestApp, we
+	// need to keep its directory around
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	e, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer e.Close()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := &App{Envy: e, ctx: context.Background(), stdout: stdout, stderr: stderr}
+
+	if err := app.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.stdin = strings.NewReader("n\n")
+
+	cmd := HideNamesCommand{app}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return without confirmation: %d", o)
+	}
+
+	app.args = []string{"-yes"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	app.args = []string{"top"}
+
+	list := ListCommand{app}
+
+	if o := list.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid list return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.HasPrefix(s, "a   ") || !strings.Contains(s, "\nb   ") {
+		t.Errorf("invalid list output: %q", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"top/b"}
+
+	get := GetCommand{app}
+
+	if o := get.Run(); o != 0 || stdout.String() != "YY\n" {
+		t.Errorf("invalid get: %d %q %s", o, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	app.args = []string{"top/a"}
+
+	drop := DropCommand{app}
+
+	if o := drop.Run(); o != 0 {
+		t.Errorf("invalid drop: %d %s", o, stderr.String())
+	}
+
+	if m, err := app.Fetch("top"); err != nil || len(m) != 1 || m["b"] != "YY" {
+		t.Errorf("invalid realm after drop: %v %v", m, err)
+	}
+
+	if err := app.VerifyAudit(); err != nil {
+		t.Errorf("invalid audit: %v", err)
+	}
+}
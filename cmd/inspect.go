@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type InspectCommand struct {
+	*App
+}
+
+func (cmd *InspectCommand) Run() int {
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	parts := strings.Split(cmd.args[0], "/")
+
+	if len(parts) != 2 {
+		cmd.usage()
+		return 1
+	}
+
+	if err := cmd.unlock(parts[0]); err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	v, err := cmd.Get(parts[0], parts[1])
+
+	if err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	i := internal.Inspect(v)
+
+	if i == nil {
+		fmt.Fprintf(cmd.stderr, "%s: not a JWT or PEM certificate\n", cmd.args[0])
+		return -1
+	}
+
+	fmt.Fprintf(cmd.stdout, "%s: %s\n", cmd.args[0], i.Kind)
+	fmt.Fprint(cmd.stdout, i.Details)
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"matt","exp":4102444800}`))
+	data := map[string]string{"a": header + "." + claims + ".c2ln", "b": "YY"}
+
+	if err := app.Add("top", data); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	cmd := InspectCommand{app}
+
+	app.args = []string{"top/a"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid 1st return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.HasPrefix(s, "top/a: jwt\n") || !strings.Contains(s, `"sub": "matt"`) {
+		t.Errorf("invalid output: %s", s)
+	}
+
+	app.args = []string{"top/b"}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid 2nd return: %d", o)
+	}
+
+	stdout.Reset()
+
+	list := ListCommand{app}
+
+	app.args = []string{"-x", "top"}
+
+	if o := list.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid list return: %d", o)
+	}
+
+	lines := strings.Split(stdout.String(), "\n")
+
+	if len(lines) != 3 || !strings.Contains(lines[0], "[jwt  exp 2100-01-01") || strings.Contains(lines[1], "[") {
+		t.Errorf("invalid list: %q", lines)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+
+	"github.com/matt4biz/envy"
 )
 
 type ListCommand struct {
@@ -13,6 +15,7 @@ type ListCommand struct {
 func (cmd *ListCommand) Run() int {
 	fs := flag.NewFlagSet("list", flag.ContinueOnError)
 	decrypt := fs.Bool("d", false, "show decrypted values")
+	inspect := fs.Bool("x", false, "inspect JWTs and certificates")
 
 	fs.Usage = cmd.usage
 
@@ -40,12 +43,20 @@ func (cmd *ListCommand) Run() int {
 
 	var err error
 
+	opts := envy.ListOptions{Decrypt: *decrypt, Inspect: *inspect}
 	parts := strings.Split(cmd.args[0], "/")
 
+	if *decrypt || *inspect {
+		if err = cmd.unlock(parts[0]); err != nil {
+			fmt.Fprintln(cmd.stderr, err)
+			return -1
+		}
+	}
+
 	if len(parts) == 1 {
-		err = cmd.List(cmd.stdout, cmd.args[0], "", *decrypt)
+		err = cmd.ListWith(cmd.stdout, cmd.args[0], "", opts)
 	} else {
-		err = cmd.List(cmd.stdout, parts[0], parts[1], *decrypt)
+		err = cmd.ListWith(cmd.stdout, parts[0], parts[1], opts)
 	}
 
 	if err != nil {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type LockCommand struct {
+	*App
+}
+
+func (cmd *LockCommand) NeedsDB() bool {
+	return false
+}
+
+func (cmd *LockCommand) Run() int {
+	fpath, err := internal.AgentSocketPath()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "lock: %s\n", err)
+		return -1
+	}
+
+	if err = internal.NewAgentClient(fpath).Lock(); err != nil {
+		fmt.Fprintf(cmd.stderr, "lock: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+type UnlockCommand struct {
+	*App
+}
+
+func (cmd *UnlockCommand) NeedsDB() bool {
+	return false
+}
+
+func (cmd *UnlockCommand) Run() int {
+	fpath, err := internal.AgentSocketPath()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "unlock: %s\n", err)
+		return -1
+	}
+
+	if err = internal.NewAgentClient(fpath).Unlock(); err != nil {
+		fmt.Fprintf(cmd.stderr, "unlock: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
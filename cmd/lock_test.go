@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+func TestLock(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	sock := path.Join(dname, "agent.sock")
+
+	os.Setenv("ENVY_AGENT_SOCK", sock)
+	defer os.Unsetenv("ENVY_AGENT_SOCK")
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+	cmd := LockCommand{app}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("lock without agent: %d", o)
+	}
+
+	a := internal.NewAgent(internal.NewTestSealer().Ring, 0)
+	l, err := a.Listen(sock)
+
+	if err != nil {
+		t.Fatal("listen", err)
+	}
+
+	defer l.Close()
+
+	go a.Serve(l) //nolint:errcheck
+
+	ac := internal.NewAgentClient(sock)
+
+	if _, err := ac.Seal([]byte("x"), nil); err != nil {
+		t.Fatal("seal", err)
+	}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if !a.Locked() {
+		t.Errorf("agent still unlocked")
+	}
+
+	if _, err := ac.Seal([]byte("x"), nil); !errors.Is(err, internal.ErrAgentLocked) {
+		t.Errorf("agent used key after lock: %v", err)
+	}
+
+	unlock := UnlockCommand{app}
+
+	if o := unlock.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid unlock return: %d", o)
+	}
+
+	if a.Locked() {
+		t.Errorf("agent still locked")
+	}
+}
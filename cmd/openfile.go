@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type OpenFileCommand struct {
+	*App
+}
+
+func (cmd *OpenFileCommand) Run() int {
+	fs := flag.NewFlagSet("open-file", flag.ContinueOnError)
+	realm := fs.String("realm", "", "add the values to a realm rather than print them")
+	textconv := fs.Bool("textconv", false, "for git diff: show keys only if not a recipient")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	cmd.args = fs.Args()
+
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+
+	if cmd.args[0] == "-" {
+		b, err = ioutil.ReadAll(cmd.stdin)
+	} else {
+		b, err = ioutil.ReadFile(cmd.args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "open-file: %s\n", err)
+		return -1
+	}
+
+	values, err := cmd.OpenFile(bytes.NewReader(b))
+
+	// a reviewer who can't decrypt the file should
+	// still see which keys were changed
+
+	if errors.Is(err, internal.ErrNotRecipient) && *textconv {
+		if values, err = sealedValues(b); err != nil {
+			fmt.Fprintf(cmd.stderr, "open-file: %s\n", err)
+			return -1
+		}
+	} else if err != nil {
+		fmt.Fprintf(cmd.stderr, "open-file: %s\n", err)
+		return -1
+	}
+
+	if *realm != "" {
+		err = cmd.Add(*realm, values)
+	} else {
+		err = internal.WriteDotenv(cmd.stdout, values)
+	}
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "open-file: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+// sealedValues shows each key with its ciphertext, which
+// changes whenever the value does.
+func sealedValues(b []byte) (map[string]string, error) {
+	f, err := internal.ReadSealedFile(bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Values, nil
+}
+
+type MergeFileCommand struct {
+	*App
+}
+
+// Run is used as a git merge driver, "envy merge-file %O %A %B",
+// which must leave the result in %A and exit non-zero on conflicts.
+func (cmd *MergeFileCommand) Run() int {
+	if len(cmd.args) != 3 {
+		cmd.usage()
+		return 1
+	}
+
+	files := make([][]byte, 3)
+
+	for i, fn := range cmd.args {
+		b, err := ioutil.ReadFile(fn)
+
+		if err != nil {
+			fmt.Fprintf(cmd.stderr, "merge-file: %s\n", err)
+			return -1
+		}
+
+		files[i] = b
+	}
+
+	b := new(bytes.Buffer)
+	conflicts, err := cmd.MergeFiles(b, files[0], files[1], files[2])
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "merge-file: %s\n", err)
+		return -1
+	}
+
+	info, err := os.Stat(cmd.args[1])
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "merge-file: %s\n", err)
+		return -1
+	}
+
+	if err = ioutil.WriteFile(cmd.args[1], b.Bytes(), info.Mode()); err != nil {
+		fmt.Fprintf(cmd.stderr, "merge-file: %s\n", err)
+		return -1
+	}
+
+	if len(conflicts) > 0 {
+		for _, k := range conflicts {
+			fmt.Fprintf(cmd.stderr, "merge-file: conflict on %s (kept ours)\n", k)
+		}
+
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type OTPCommand struct {
+	*App
+}
+
+func (cmd *OTPCommand) Run() int {
+	fs := flag.NewFlagSet("otp", flag.ContinueOnError)
+	quiet := fs.Bool("q", false, "print only the code")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil || fs.NArg() != 1 {
+		cmd.usage()
+		return 1
+	}
+
+	parts := strings.Split(fs.Arg(0), "/")
+
+	if len(parts) != 2 {
+		cmd.usage()
+		return 1
+	}
+
+	if err := cmd.unlock(parts[0]); err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	code, left, err := cmd.TOTP(parts[0], parts[1])
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "otp: %s\n", err)
+		return -1
+	}
+
+	if *quiet {
+		fmt.Fprintln(cmd.stdout, code)
+	} else {
+		secs := (left + time.Second - 1) / time.Second
+		fmt.Fprintf(cmd.stdout, "%s (%ds left)\n", code, secs)
+	}
+
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/matt4biz/envy"
+)
+
+func TestOTP(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	vals := map[string]envy.Value{
+		"CODE": {Data: "otpauth://totp/ACME:jo?secret=JBSWY3DPEHPK3PXP", Type: envy.TypeTOTP},
+		"TEXT": {Data: "x"},
+	}
+
+	if err := app.AddValues("top", vals); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"top/CODE"}
+
+	cmd := OTPCommand{app}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if s := stdout.String(); !regexp.MustCompile(`^\d{6} \(\d+s left\)\n$`).MatchString(s) {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-q", "top/CODE"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if s := stdout.String(); !regexp.MustCompile(`^\d{6}\n$`).MatchString(s) {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	app.args = []string{"top/TEXT"}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid return for a string: %d", o)
+	}
+
+	if s := stderr.String(); !strings.Contains(s, "not a TOTP value") {
+		t.Errorf("invalid error: %q", s)
+	}
+
+	// exec passes the code, not the seed
+
+	stdout.Reset()
+	app.args = []string{"top/CODE", "/bin/sh", "-c", "echo $CODE"}
+
+	exec := ExecCommand{app}
+
+	if o := exec.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid exec return: %d", o)
+	}
+
+	if s := stdout.String(); !regexp.MustCompile(`^\d{6}\n$`).MatchString(s) {
+		t.Errorf("invalid exec output: %q", s)
+	}
+}
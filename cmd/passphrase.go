@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const passphraseEnv = "ENVY_PASSPHRASE"
+
+var (
+	ErrNoPassphrase       = errors.New("no passphrase (and no terminal to ask for one)")
+	ErrPassphraseMismatch = errors.New("passphrases don't match")
+)
+
+// readPassphrase gets a passphrase from a file, if given, or
+// the environment variable, and otherwise asks for it on the
+// terminal (not stdin, which may be in use for data); if confirm
+// is set, it asks twice.
+func (a *App) readPassphrase(prompt, fpath, env string, confirm bool) ([]byte, error) {
+	if fpath != "" {
+		b, err := ioutil.ReadFile(fpath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.TrimRight(b, "\r\n"), nil
+	}
+
+	if p, ok := os.LookupEnv(env); ok {
+		return []byte(p), nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+
+	if err != nil {
+		return nil, ErrNoPassphrase
+	}
+
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s: ", prompt)
+
+	p, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		fmt.Fprintf(tty, "%s (again): ", prompt)
+
+		p2, err := terminal.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(tty)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(p, p2) {
+			return nil, ErrPassphraseMismatch
+		}
+	}
+
+	if len(p) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	return p, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/matt4biz/envy"
+)
+
+// realmPassphraseEnv is checked for a protected realm's passphrase
+// (rather than passphraseEnv, which is for backups).
+const realmPassphraseEnv = "ENVY_REALM_PASSPHRASE"
+
+type ProtectCommand struct {
+	*App
+}
+
+func (cmd *ProtectCommand) Run() int {
+	fs := flag.NewFlagSet("protect", flag.ContinueOnError)
+	pfile := fs.String("passphrase-file", "", "read the passphrase from a file")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	cmd.args = fs.Args()
+
+	if len(cmd.args) != 1 {
+		cmd.usage()
+		return 1
+	}
+
+	realm := cmd.args[0]
+
+	// changing the passphrase needs the old one first
+
+	if err := cmd.unlock(realm); err != nil {
+		fmt.Fprintf(cmd.stderr, "protect: %s\n", err)
+		return -1
+	}
+
+	p, err := cmd.readPassphrase("new passphrase for "+realm, *pfile, realmPassphraseEnv, true)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "protect: %s\n", err)
+		return -1
+	}
+
+	if err = cmd.Protect(realm, p); err != nil {
+		fmt.Fprintf(cmd.stderr, "protect: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+type UnprotectCommand struct {
+	*App
+}
+
+func (cmd *UnprotectCommand) Run() int {
+	if len(cmd.args) != 1 {
+		cmd.usage()
+		return 1
+	}
+
+	realm := cmd.args[0]
+
+	if err := cmd.unlock(realm); err != nil {
+		fmt.Fprintf(cmd.stderr, "unprotect: %s\n", err)
+		return -1
+	}
+
+	if err := cmd.Unprotect(realm); err != nil {
+		fmt.Fprintf(cmd.stderr, "unprotect: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+// unlock asks for a protected realm's passphrase before any
+// of its values are revealed; other realms need nothing.
+func (a *App) unlock(realm string) error {
+	ok, err := a.Protected(realm)
+
+	if err != nil || !ok {
+		return err
+	}
+
+	p, err := a.readPassphrase("passphrase for "+realm, "", realmPassphraseEnv, false)
+
+	if err != nil {
+		return err
+	}
+
+	return a.Unlock(realm, p)
+}
+
+// confirmDestroy asks before a destructive operation on a
+// protected realm, unless yes is set; others go ahead.
+func (a *App) confirmDestroy(realm, what string, yes bool) (bool, error) {
+	ok, err := a.Protected(realm)
+
+	if err != nil || !ok || yes {
+		return err == nil, err
+	}
+
+	return a.confirm(fmt.Sprintf("%s is protected; really %s?", realm, what)), nil
+}
+
+// confirmReplace asks before a restore (or receive) replaces
+// any protected realm that would lose keys, and unlocks it.
+func (a *App) confirmReplace(changes []envy.Change, yes bool) (bool, error) {
+	seen := make(map[string]bool)
+
+	for _, c := range changes {
+		if c.Kind != "drop" || seen[c.Realm] {
+			continue
+		}
+
+		seen[c.Realm] = true
+
+		if ok, err := a.confirmDestroy(c.Realm, "replace it", yes); err != nil || !ok {
+			return ok, err
+		}
+
+		if err := a.unlock(c.Realm); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestProtect(t *testing.T) { //nolint:gocyclo
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	pfile := path.Join(dname, "pass")
+
+	if err = ioutil.WriteFile(pfile, []byte("sesame\n"), 0600); err != nil {
+		t.Fatal("passphrase", err)
+	}
+
+	if err = app.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"-passphrase-file", pfile, "top"}
+
+	if o := (&ProtectCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid protect return: %d: %s", o, stderr.String())
+	}
+
+	// a new command needs the passphrase, as if run again
+
+	defer os.Unsetenv(realmPassphraseEnv)
+
+	if err = os.Setenv(realmPassphraseEnv, "barley"); err != nil {
+		t.Fatal("setenv", err)
+	}
+
+	app.args = []string{"top/a"}
+
+	if o := (&GetCommand{app}).Run(); o != -1 {
+		t.Errorf("invalid get return with wrong passphrase: %d", o)
+	}
+
+	if !strings.Contains(stderr.String(), "wrong passphrase") {
+		t.Errorf("invalid errors: %s", stderr.String())
+	}
+
+	_ = os.Setenv(realmPassphraseEnv, "sesame")
+	stderr.Reset()
+
+	app.args = []string{"top/a"}
+
+	if o := (&GetCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid get return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); s != "XX\n" {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	// dropping asks first
+
+	app.stdin = strings.NewReader("n\n")
+	app.args = []string{"top/a"}
+
+	if o := (&DropCommand{app}).Run(); o != 1 {
+		t.Errorf("invalid drop return when refused: %d", o)
+	}
+
+	if _, err = app.Get("top", "a"); err != nil {
+		t.Errorf("dropped anyway: %v", err)
+	}
+
+	app.stdin = strings.NewReader("y\n")
+	app.args = []string{"top/a"}
+
+	if o := (&DropCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid drop return: %d: %s", o, stderr.String())
+	}
+
+	app.stdin = nil
+	app.args = []string{"-yes", "top/b"}
+
+	if o := (&DropCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid drop -yes return: %d: %s", o, stderr.String())
+	}
+
+	// clearing it keeps the passphrase
+
+	app.stdin = strings.NewReader(`{"c": "ZZ"}`)
+	app.args = []string{"-clear", "-yes", "top", "-"}
+
+	if o := (&WriteCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid write -clear return: %d: %s", o, stderr.String())
+	}
+
+	if ok, err := app.Protected("top"); err != nil || !ok {
+		t.Errorf("not protected after clear: %v", err)
+	}
+
+	// backing it up needs the passphrase (given above), and
+	// replacing it asks first
+
+	defer os.Unsetenv(passphraseEnv)
+
+	_ = os.Setenv(passphraseEnv, "barley")
+	bfile := path.Join(dname, "backup")
+
+	app.args = []string{bfile}
+
+	if o := (&BackupCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid backup return: %d: %s", o, stderr.String())
+	}
+
+	if err = app.Set("top", "d", "WW"); err != nil {
+		t.Fatal("set", err)
+	}
+
+	app.stdin = nil
+	app.args = []string{"-replace", bfile}
+
+	if o := (&RestoreCommand{app}).Run(); o != 1 {
+		t.Errorf("invalid restore return when refused: %d", o)
+	}
+
+	if _, err = app.Get("top", "d"); err != nil {
+		t.Errorf("replaced anyway: %v", err)
+	}
+
+	app.args = []string{"-replace", "-yes", bfile}
+
+	if o := (&RestoreCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid restore -yes return: %d: %s", o, stderr.String())
+	}
+
+	if _, err = app.Get("top", "d"); err == nil {
+		t.Errorf("not replaced")
+	}
+
+	app.args = []string{"top"}
+
+	if o := (&UnprotectCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid unprotect return: %d: %s", o, stderr.String())
+	}
+
+	if ok, err := app.Protected("top"); err != nil || ok {
+		t.Errorf("still protected: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+)
+
+type PubkeyCommand struct {
+	*App
+}
+
+func (cmd *PubkeyCommand) Run() int {
+	k, err := cmd.PublicKey()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "pubkey: %s\n", err)
+		return -1
+	}
+
+	fmt.Fprintln(cmd.stdout, k)
+	return 0
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"strings"
+	"path/filepath"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
 )
 
 type ReadCommand struct {
@@ -14,6 +18,8 @@ type ReadCommand struct {
 func (cmd *ReadCommand) Run() int {
 	fs := flag.NewFlagSet("list", flag.ContinueOnError)
 	unquote := fs.Bool("q", false, "unquote embedded JSON")
+	nest := fs.String("nest", "", "nest keys: dot, env, or a separator")
+	asYAML := fs.Bool("yaml", false, "write YAML")
 
 	fs.Usage = cmd.usage
 
@@ -29,7 +35,19 @@ func (cmd *ReadCommand) Run() int {
 		return 1
 	}
 
-	m, err := cmd.FetchAsJSON(cmd.args[0])
+	if err := cmd.unlock(cmd.args[0]); err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
+
+	var f *envy.Flattening
+
+	if *nest != "" {
+		nf := envy.ParseFlattening(*nest)
+		f = &nf
+	}
+
+	doc, err := cmd.FetchDocument(cmd.args[0], f)
 
 	if err != nil {
 		fmt.Fprintln(cmd.stderr, err)
@@ -37,23 +55,24 @@ func (cmd *ReadCommand) Run() int {
 	}
 
 	if *unquote {
-		// we're going to have to do this the hard way
+		envy.UnquoteJSON(doc)
+	}
 
-		v := string(m)
+	var m []byte
 
-		v = strings.Trim(v, "\"")
-		v = strings.ReplaceAll(v, `\"`, `"`)
-		v = strings.ReplaceAll(v, `"{`, `{`)
-		v = strings.ReplaceAll(v, `}"`, `}`)
-		v = strings.ReplaceAll(v, `\\n`, ``)
+	if *asYAML || isYAML(cmd.args[1]) {
+		m, err = internal.EncodeYAML(doc)
+	} else if m, err = json.Marshal(doc); err == nil {
+		// it's nice to have the file (or stdout)
+		// have a trailing newline
 
-		m = []byte(v)
+		m = append(m, '\n')
 	}
 
-	// it's nice to have the file (or stdout)
-	// have a trailing newline
-
-	m = append(m, '\n')
+	if err != nil {
+		fmt.Fprintln(cmd.stderr, err)
+		return -1
+	}
 
 	if cmd.args[1] != "-" {
 		if err := ioutil.WriteFile(cmd.args[1], m, 0600); err != nil {
@@ -69,3 +88,9 @@ func (cmd *ReadCommand) Run() int {
 
 	return 0
 }
+
+// isYAML reports whether a file's name says it's YAML.
+func isYAML(fpath string) bool {
+	ext := filepath.Ext(fpath)
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -111,7 +112,7 @@ func TestReadUnquoted(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 	app := NewTestApp(t, stdout, stderr)
-	input := map[string]string{"a": `{"one":{"a":"1","b":"2"},\n "two":{"a":"5","b":"6"}}`}
+	input := map[string]string{"a": "{\"one\":{\"a\":\"1\",\"b\":\"2\"},\n \"two\":{\"a\":\"5\",\"b\":\"6\"}}"}
 
 	if err := app.Add("test", input); err != nil {
 		t.Fatal("setup", err)
@@ -139,3 +140,87 @@ func TestReadUnquoted(t *testing.T) {
 		t.Errorf("invalid data: %+v (should be %+v)", readData, expData)
 	}
 }
+
+func TestReadUnquotedIntact(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	// none of these hold JSON, so they're left alone
+
+	input := map[string]string{
+		"a": `say "{hi}" then \n`,
+		"b": `{not json}"`,
+		"c": `{"x": "a \"{quoted}\" value\n"} and more`,
+	}
+
+	if err := app.Add("test", input); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"-q", "test", "-"}
+
+	if o := (&ReadCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid return: %d: %s", o, stderr.String())
+	}
+
+	var readData map[string]string
+
+	if err := json.NewDecoder(stdout).Decode(&readData); err != nil {
+		t.Fatal("decode", err)
+	}
+
+	if !reflect.DeepEqual(readData, input) {
+		t.Errorf("invalid data: %q", readData)
+	}
+}
+
+func TestReadNested(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	input := "db:\n  host: example.com\n  port: 5432\n  replicas: [a, b]\ndebug: true\n"
+
+	app.stdin = strings.NewReader(input)
+	app.args = []string{"-yaml", "-flatten", "env", "test", "-"}
+
+	if o := (&WriteCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid write return: %d: %s", o, stderr.String())
+	}
+
+	m, err := app.Fetch("test")
+
+	if err != nil {
+		t.Fatal("fetch", err)
+	}
+
+	exp := map[string]string{"DB__HOST": "example.com", "DB__PORT": "5432", "DB__REPLICAS": `["a","b"]`, "DEBUG": "true"}
+
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("invalid values: %v", m)
+	}
+
+	app.args = []string{"-nest", "env", "test", "-"}
+
+	if o := (&ReadCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid read return: %d: %s", o, stderr.String())
+	}
+
+	exp2 := `{"db":{"host":"example.com","port":5432,"replicas":["a","b"]},"debug":true}` + "\n"
+
+	if s := stdout.String(); s != exp2 {
+		t.Errorf("invalid JSON: %s", s)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-nest", "env", "-yaml", "test", "-"}
+
+	if o := (&ReadCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid read return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); s != "db:\n  host: example.com\n  port: 5432\n  replicas:\n  - a\n  - b\ndebug: true\n" {
+		t.Errorf("invalid YAML: %s", s)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/matt4biz/envy"
+)
+
+type ReceiveCommand struct {
+	*App
+}
+
+func (cmd *ReceiveCommand) Run() int {
+	fs := flag.NewFlagSet("receive", flag.ContinueOnError)
+	realm := fs.String("realm", "", "import under another realm name")
+	replace := fs.Bool("replace", false, "replace the realm rather than merge")
+	dryRun := fs.Bool("n", false, "only show what would change")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	cmd.args = fs.Args()
+
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	reader := cmd.stdin
+
+	if cmd.args[0] != "-" {
+		file, err := os.Open(cmd.args[0])
+
+		if err != nil {
+			fmt.Fprintf(cmd.stderr, "receive: %s\n", err)
+			return -1
+		}
+
+		defer file.Close()
+
+		reader = file
+	}
+
+	opts := envy.RestoreOptions{Replace: *replace, DryRun: *dryRun}
+	changes, err := cmd.receive(reader, *realm, opts, *yes)
+
+	if err == errRefused {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(cmd.stderr, "receive: %s\n", err)
+		return -1
+	}
+
+	printChanges(cmd.stdout, changes)
+	return 0
+}
+
+// receive checks by doing a dry run first, so the input is read
+// into memory, and asks before changing a realm that's already
+// here, as anyone may have sent the share.
+func (cmd *ReceiveCommand) receive(r io.Reader, realm string, opts envy.RestoreOptions, yes bool) ([]envy.Change, error) {
+	b, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dry := opts
+	dry.DryRun = true
+
+	changes, err := cmd.Receive(bytes.NewReader(b), realm, dry)
+
+	if err != nil || opts.DryRun || len(changes) == 0 {
+		return changes, err
+	}
+
+	if ok, err := cmd.confirmReceive(changes[0].Realm, yes); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRefused
+	}
+
+	return cmd.Receive(bytes.NewReader(b), realm, opts)
+}
+
+// confirmReceive asks before a share changes a realm that
+// already exists, naming it, and unlocks it if it's protected.
+func (cmd *ReceiveCommand) confirmReceive(realm string, yes bool) (bool, error) {
+	realms, err := cmd.Realms()
+
+	if err != nil {
+		return false, err
+	}
+
+	i := sort.SearchStrings(realms, realm)
+
+	if i == len(realms) || realms[i] != realm {
+		return true, nil
+	}
+
+	protected, err := cmd.Protected(realm)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !yes {
+		q := fmt.Sprintf("the share is for %s, which exists; update it?", realm)
+
+		if protected {
+			q = fmt.Sprintf("the share is for %s, which is protected; really update it?", realm)
+		}
+
+		if !cmd.confirm(q) {
+			return false, nil
+		}
+	}
+
+	return true, cmd.unlock(realm)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/matt4biz/envy"
+)
+
+// refresh gets a new access token for a refreshable realm whose
+// token has expired, so that it's current when it's read; the
+// key, if given, must be the token (or its expiry) to need it.
+func (a *App) refresh(realm, key string) error {
+	if key != "" && key != envy.OAuthAccessToken && key != envy.OAuthExpiry {
+		return nil
+	}
+
+	if ok, err := a.Refreshable(realm); err != nil || !ok {
+		return nil // not refreshable, or it'll fail when it's read
+	}
+
+	_, err := a.AccessToken(a.ctx, realm)
+	return err
+}
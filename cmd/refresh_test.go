@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matt4biz/envy"
+)
+
+func TestRefresh(t *testing.T) {
+	calls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("client_id") != "public" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprintf(w, `{"access_token":"access-%d","expires_in":3600}`, calls)
+	}))
+
+	defer ts.Close()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	vals := map[string]string{
+		envy.OAuthTokenURL:     ts.URL,
+		envy.OAuthClientID:     "public",
+		envy.OAuthRefreshToken: "refresh",
+		"OTHER":                "x",
+	}
+
+	if err := app.Add("api", vals); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	// reading another key doesn't need a token
+
+	app.args = []string{"api/OTHER"}
+
+	get := GetCommand{app}
+
+	if o := get.Run(); o != 0 || calls != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d (%d calls)", o, calls)
+	}
+
+	stdout.Reset()
+	app.args = []string{"api/" + envy.OAuthAccessToken}
+
+	if o := get.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if s := stdout.String(); s != "access-1\n" {
+		t.Errorf("invalid token: %q", s)
+	}
+
+	// exec gets the token that's been saved
+
+	stdout.Reset()
+	app.args = []string{"api", "/bin/sh", "-c", "echo $" + envy.OAuthAccessToken}
+
+	exec := ExecCommand{app}
+
+	if o := exec.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if s := stdout.String(); s != "access-1\n" || calls != 1 {
+		t.Errorf("invalid token: %q (%d calls)", s, calls)
+	}
+
+	// a failed refresh stops the command
+
+	if err := app.Set("api", envy.OAuthClientID, "other"); err != nil {
+		t.Fatal("set", err)
+	}
+
+	if err := app.Set("api", envy.OAuthAccessToken, ""); err != nil {
+		t.Fatal("set", err)
+	}
+
+	if o := exec.Run(); o != -1 {
+		t.Errorf("invalid return: %d", o)
+	}
+
+	if s := stderr.String(); !strings.Contains(s, "token refresh failed") {
+		t.Errorf("invalid error: %q", s)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var ErrNoRealm = errors.New("no realm given (use -realm or realm/KEY)")
+
+type RenderCommand struct {
+	*App
+}
+
+func (cmd *RenderCommand) Run() int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	realm := fs.String("realm", "", "realm whose values the template reads")
+	out := fs.String("o", "", "output file, written 0600 (default stdout)")
+	watch := fs.Bool("watch", false, "render again when values change (needs -o)")
+	interval := fs.Duration("interval", 2*time.Second, "how often to check for changes")
+
+	fs.Usage = cmd.usage
+
+	args, err := parseInterspersed(fs, cmd.args)
+
+	if err != nil || len(args) != 1 || (*watch && *out == "") {
+		cmd.usage()
+		return 1
+	}
+
+	r := renderer{App: cmd.App, realm: *realm}
+
+	if r.tmpl, err = r.parse(args[0]); err != nil {
+		fmt.Fprintf(cmd.stderr, "render: %s\n", err)
+		return -1
+	}
+
+	if *watch {
+		err = r.watch(cmd.ctx, *out, *interval)
+	} else {
+		err = r.renderTo(*out)
+	}
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "render: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+// renderer runs a template with the values of a realm as its
+// data, along with functions to read other values and to
+// format them.
+type renderer struct {
+	*App
+
+	realm string
+	tmpl  *template.Template
+	last  []byte
+}
+
+func (r *renderer) parse(fpath string) (*template.Template, error) {
+	t := template.New(filepath.Base(fpath)).Funcs(r.funcs()).Option("missingkey=zero")
+
+	return t.ParseFiles(fpath)
+}
+
+func (r *renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"get":     r.get,
+		"default": defaultValue,
+		"b64enc":  func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":  b64dec,
+		"json":    toJSON,
+		"shquote": shellQuote,
+	}
+}
+
+// get reads KEY from the realm, or realm/KEY from another.
+func (r *renderer) get(ref string) (string, error) {
+	realm, key := r.realm, ref
+
+	if i := strings.LastIndexByte(ref, '/'); i >= 0 {
+		realm, key = ref[:i], ref[i+1:]
+	}
+
+	if realm == "" {
+		return "", fmt.Errorf("%s: %w", ref, ErrNoRealm)
+	}
+
+	if err := r.unlock(realm); err != nil {
+		return "", err
+	}
+
+	v, err := r.GetValue(realm, key)
+	return v.Data, err
+}
+
+// defaultValue takes its arguments in the order that
+// lets it be used in a pipeline, e.g., {{.X | default "y"}}.
+func defaultValue(d, v string) string {
+	if v == "" {
+		return d
+	}
+
+	return v
+}
+
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (r *renderer) render() ([]byte, error) {
+	data := make(map[string]string)
+
+	if r.realm != "" {
+		if err := r.unlock(r.realm); err != nil {
+			return nil, err
+		}
+
+		m, err := r.Fetch(r.realm)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data = m
+	}
+
+	var buf bytes.Buffer
+
+	if err := r.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderTo writes the output to the file (or stdout), unless
+// it's the same as the last time.
+func (r *renderer) renderTo(fpath string) error {
+	b, err := r.render()
+
+	if err != nil {
+		return err
+	}
+
+	if r.last != nil && bytes.Equal(b, r.last) {
+		return nil
+	}
+
+	r.last = b
+
+	if fpath == "" {
+		_, err = r.stdout.Write(b)
+		return err
+	}
+
+	return writePrivate(fpath, b)
+}
+
+// writePrivate replaces a file with mode 0600, so that it's
+// never readable by others, nor seen half-written.
+func writePrivate(fpath string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), fpath)
+}
+
+// watch renders the output, and then again whenever any values
+// change, until ctx is done (e.g., on a signal); the DB is
+// suspended in between, so it's only read when the file has
+// changed, and the output is only rendered again if the (sealed)
+// values have.
+func (r *renderer) watch(ctx context.Context, fpath string, interval time.Duration) error {
+	if err := r.renderTo(fpath); err != nil {
+		return err
+	}
+
+	fp, err := r.Fingerprint()
+
+	if err != nil {
+		return err
+	}
+
+	if err = r.Suspend(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if rerr := r.Resume(); rerr != nil {
+			fmt.Fprintf(r.stderr, "render: %s\n", rerr)
+		}
+	}()
+
+	stamp, err := r.Modified()
+
+	if err != nil {
+		return err
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+
+		if m, err := r.Modified(); err != nil || m.Equal(stamp) {
+			continue
+		}
+
+		if err = r.Resume(); err != nil {
+			return err
+		}
+
+		if fp, err = r.renderChanged(fpath, fp); err != nil {
+			fmt.Fprintf(r.stderr, "render: %s\n", err)
+		}
+
+		if err = r.Suspend(); err != nil {
+			return err
+		}
+
+		if stamp, err = r.Modified(); err != nil {
+			return err
+		}
+	}
+}
+
+// renderChanged renders the output if the values' fingerprint
+// has changed, returning the new one.
+func (r *renderer) renderChanged(fpath, fp string) (string, error) {
+	nfp, err := r.Fingerprint()
+
+	if err != nil || nfp == fp {
+		return fp, err
+	}
+
+	if err = r.renderTo(fpath); err != nil {
+		return fp, err
+	}
+
+	// rendering adds to the audit log, but not the values
+
+	return nfp, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+const testTemplate = `url={{ .URL }}
+pass={{ get "db/PASS" | shquote }}
+level={{ .LEVEL | default "info" }}
+b64={{ .URL | b64enc }}
+dec={{ "aGk=" | b64dec }}
+json={{ get "PASS2" | json }}
+`
+
+func TestRender(t *testing.T) {
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	tname := filepath.Join(dname, "app.tmpl")
+
+	if err = ioutil.WriteFile(tname, []byte(testTemplate), 0644); err != nil {
+		t.Fatal("template", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("db", map[string]string{"PASS": "it's"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	vals := map[string]envy.Value{
+		"URL":   {Data: "x://${db/PASS}", Type: envy.TypeTemplate},
+		"PASS2": {Data: `a"b`},
+	}
+
+	if err := app.AddValues("app", vals); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"-realm", "app", tname}
+
+	cmd := RenderCommand{app}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	exp := `url=x://it's
+pass='it'\''s'
+level=info
+b64=eDovL2l0J3M=
+dec=hi
+json="a\"b"
+`
+
+	if s := stdout.String(); s != exp {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	oname := filepath.Join(dname, "app.conf")
+
+	app.args = []string{"-realm", "app", "-o", oname, tname}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	fi, err := os.Stat(oname)
+
+	if err != nil {
+		t.Fatal("stat", err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("invalid mode: %v", fi.Mode())
+	}
+
+	if err = ioutil.WriteFile(tname, []byte(`{{ get "NONE" }}`), 0644); err != nil {
+		t.Fatal("template", err)
+	}
+
+	stdout.Reset()
+	app.args = []string{"-realm", "app", tname}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid return for missing key: %d", o)
+	}
+
+	app.args = []string{"-watch", tname}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return for -watch without -o: %d", o)
+	}
+}
+
+func TestRenderWatch(t *testing.T) {
+	keyring.MockInit()
+
+	// the DB's closed and reopened while watching, so unlike
+	// NewTestApp, we need to keep its directory around
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	e, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer e.Close()
+
+	tname := filepath.Join(dname, "app.tmpl")
+	oname := filepath.Join(dname, "app.conf")
+
+	if err = ioutil.WriteFile(tname, []byte("a={{ .A }}\n"), 0644); err != nil {
+		t.Fatal("template", err)
+	}
+
+	if err = e.Add("app", map[string]string{"A": "1"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := &App{Envy: e, ctx: context.Background(), stdout: stdout, stderr: stderr}
+	r := renderer{App: app, realm: "app"}
+
+	if r.tmpl, err = r.parse(tname); err != nil {
+		t.Fatal("parse", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	defer cancel()
+
+	go func() {
+		done <- r.watch(ctx, oname, 10*time.Millisecond)
+	}()
+
+	waitFor(t, oname, "a=1\n")
+
+	// another "process" changes the value while the
+	// watcher has the DB suspended
+
+	e2, err := envy.NewWithSealer(dname, internal.NewTestSealer())
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	if err = e2.Set("app", "A", "2"); err != nil {
+		t.Fatal("set", err)
+	}
+
+	e2.Close()
+
+	waitFor(t, oname, "a=2\n")
+
+	cancel()
+
+	if err = <-done; err != nil {
+		t.Errorf("watch: %s", err)
+	}
+
+	if v, err := e.Get("app", "A"); err != nil || v != "2" {
+		t.Errorf("invalid value after resume: %q %v", v, err)
+	}
+}
+
+func waitFor(t *testing.T, fname, exp string) {
+	t.Helper()
+
+	var s string
+
+	for i := 0; i < 200; i++ {
+		if b, err := ioutil.ReadFile(fname); err == nil {
+			if s = string(b); s == exp {
+				return
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("invalid output: %q", s)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/matt4biz/envy"
+)
+
+type RestoreCommand struct {
+	*App
+}
+
+func (cmd *RestoreCommand) Run() int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	pfile := fs.String("passphrase-file", "", "read the passphrase from a file")
+	replace := fs.Bool("replace", false, "replace restored realms rather than merge")
+	dryRun := fs.Bool("n", false, "only show what would change")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	cmd.args = fs.Args()
+
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	reader := cmd.stdin
+
+	if cmd.args[0] != "-" {
+		file, err := os.Open(cmd.args[0])
+
+		if err != nil {
+			fmt.Fprintf(cmd.stderr, "restore: %s\n", err)
+			return -1
+		}
+
+		defer file.Close()
+
+		reader = file
+	}
+
+	p, err := cmd.readPassphrase("backup passphrase", *pfile, passphraseEnv, false)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "restore: %s\n", err)
+		return -1
+	}
+
+	opts := envy.RestoreOptions{Replace: *replace, DryRun: *dryRun}
+
+	restore := func(r io.Reader, opts envy.RestoreOptions) ([]envy.Change, error) {
+		return cmd.Restore(r, p, opts)
+	}
+
+	changes, err := cmd.replace(reader, opts, *yes, restore)
+
+	if err == errRefused {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(cmd.stderr, "restore: %s\n", err)
+		return -1
+	}
+
+	printChanges(cmd.stdout, changes)
+	return 0
+}
+
+var errRefused = errors.New("refused")
+
+// restoreFunc restores (or receives) from its input.
+type restoreFunc func(io.Reader, envy.RestoreOptions) ([]envy.Change, error)
+
+// replace runs a restore (or receive), but if it would replace
+// any protected realm, it checks by doing a dry run first, so
+// the input is read into memory.
+func (a *App) replace(r io.Reader, opts envy.RestoreOptions, yes bool, restore restoreFunc) ([]envy.Change, error) {
+	if !opts.Replace || opts.DryRun {
+		return restore(r, opts)
+	}
+
+	b, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dry := opts
+	dry.DryRun = true
+
+	changes, err := restore(bytes.NewReader(b), dry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := a.confirmReplace(changes, yes); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRefused
+	}
+
+	return restore(bytes.NewReader(b), opts)
+}
+
+// printChanges shows what a restore did (or would do),
+// like a diff.
+func printChanges(w io.Writer, changes []envy.Change) {
+	marks := map[string]string{"add": "+", "update": "~", "drop": "-", "same": "="}
+
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s %s/%s\n", marks[c.Kind], c.Realm, c.Key)
+	}
+}
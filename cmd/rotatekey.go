@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+type RotateKeyCommand struct {
+	*App
+}
+
+func (cmd *RotateKeyCommand) Run() int {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	all := fs.Bool("all", false, "rotate every realm and upgrade the DB")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	if *all {
+		if fs.NArg() > 0 {
+			cmd.usage()
+			return 1
+		}
+
+		if err := cmd.Upgrade(); err != nil {
+			fmt.Fprintf(cmd.stderr, "rotate-key: %s\n", err)
+			return -1
+		}
+
+		return 0
+	}
+
+	if fs.NArg() < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	for _, r := range fs.Args() {
+		if err := cmd.RotateRealmKey(r); err != nil {
+			fmt.Fprintf(cmd.stderr, "rotate-key: %s\n", err)
+			return -1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRotateKey(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("top", map[string]string{"a": "XX"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"top"}
+
+	cmd := RotateKeyCommand{app}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return: %d", o)
+	}
+
+	if v, err := app.Get("top", "a"); err != nil || v != "XX" {
+		t.Errorf("invalid value after rotation: %s %v", v, err)
+	}
+
+	app.args = []string{"none"}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid return for missing realm: %d", o)
+	}
+
+	app.args = []string{"-all", "top"}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return for -all with realms: %d", o)
+	}
+
+	app.args = []string{"-all"}
+
+	if o := cmd.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid return for -all: %d", o)
+	}
+
+	if v, err := app.Get("top", "a"); err != nil || v != "XX" {
+		t.Errorf("invalid value after upgrade: %s %v", v, err)
+	}
+}
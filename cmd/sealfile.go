@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+type SealFileCommand struct {
+	*App
+}
+
+func (cmd *SealFileCommand) Run() int {
+	var to recipients
+
+	fs := flag.NewFlagSet("seal-file", flag.ContinueOnError)
+	realm := fs.String("realm", "", "seal a realm rather than a dotenv file")
+	out := fs.String("o", "", "output file, resealed if it exists")
+	rotate := fs.Bool("rotate", false, "use a new data key and only the given recipients")
+
+	fs.Var(&to, "to", "recipient's public key (or a file with it)")
+	fs.Usage = cmd.usage
+
+	args, err := parseInterspersed(fs, cmd.args)
+
+	if err != nil || (len(args) < 1) == (*realm == "") {
+		cmd.usage()
+		return 1
+	}
+
+	var values map[string]string
+
+	if *realm != "" {
+		if err = cmd.unlock(*realm); err == nil {
+			values, err = cmd.Fetch(*realm)
+		}
+	} else {
+		values, err = cmd.readDotenv(args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "seal-file: %s\n", err)
+		return -1
+	}
+
+	opts := envy.SealFileOptions{Recipients: to, Rotate: *rotate}
+
+	if *out != "" {
+		prev, err := ioutil.ReadFile(*out)
+
+		if err == nil {
+			opts.Prev = bytes.NewReader(prev)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(cmd.stderr, "seal-file: %s\n", err)
+			return -1
+		}
+	}
+
+	b := new(bytes.Buffer)
+
+	if err = cmd.SealFile(b, values, opts); err != nil {
+		fmt.Fprintf(cmd.stderr, "seal-file: %s\n", err)
+		return -1
+	}
+
+	// the sealed file is meant to be committed, so it's
+	// not private to the user
+
+	if *out != "" {
+		err = ioutil.WriteFile(*out, b.Bytes(), 0644) //nolint:gosec
+	} else {
+		_, err = cmd.stdout.Write(b.Bytes())
+	}
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "seal-file: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+func (cmd *SealFileCommand) readDotenv(fn string) (map[string]string, error) {
+	reader := cmd.stdin
+
+	if fn != "-" {
+		file, err := os.Open(fn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		reader = file
+	}
+
+	return internal.ParseDotenv(reader)
+}
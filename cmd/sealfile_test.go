@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSealOpenFile(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	alice := NewTestApp(t, stdout, stderr)
+	bob := NewTestApp(t, stdout, stderr)
+
+	bobKey, err := bob.PublicKey()
+
+	if err != nil {
+		t.Fatal("pubkey", err)
+	}
+
+	fname := path.Join(dname, "prod.envy")
+
+	alice.stdin = strings.NewReader("a=XX\nb=YY\n")
+	alice.args = []string{"-o", fname, "-to", bobKey, "-"}
+
+	seal := SealFileCommand{alice}
+
+	if o := seal.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid seal return: %d", o)
+	}
+
+	first, _ := ioutil.ReadFile(fname)
+
+	if strings.Contains(string(first), "=XX") || !strings.Contains(string(first), "\na=envy:v1:") {
+		t.Errorf("invalid sealed file: %s", first)
+	}
+
+	// resealing a realm changes only what's changed
+
+	if err := alice.Add("top", map[string]string{"a": "XX", "b": "ZZ"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	alice.args = []string{"-realm", "top", "-o", fname}
+
+	if o := seal.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid reseal return: %d", o)
+	}
+
+	second, _ := ioutil.ReadFile(fname)
+
+	if lineOf(first, "a=") != lineOf(second, "a=") || lineOf(first, "b=") == lineOf(second, "b=") {
+		t.Errorf("invalid reseal: %s", second)
+	}
+
+	bob.args = []string{fname}
+
+	open := OpenFileCommand{bob}
+
+	if o := open.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid open return: %d", o)
+	}
+
+	if s := stdout.String(); s != "a=XX\nb=ZZ\n" {
+		t.Errorf("invalid open output: %q", s)
+	}
+
+	// carol isn't a recipient, but can see a diff of keys
+
+	carol := NewTestApp(t, stdout, stderr)
+	carol.args = []string{fname}
+
+	open = OpenFileCommand{carol}
+
+	if o := open.Run(); o != -1 {
+		t.Errorf("invalid open return: %d", o)
+	}
+
+	stdout.Reset()
+	carol.args = []string{"-textconv", fname}
+
+	if o := open.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid textconv return: %d", o)
+	}
+
+	if s := stdout.String(); !strings.HasPrefix(s, lineOf(second, "a=")+"\n") {
+		t.Errorf("invalid textconv output: %q", s)
+	}
+
+	bob.args = []string{"-realm", "mine", fname}
+	open = OpenFileCommand{bob}
+
+	if o := open.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid import return: %d", o)
+	}
+
+	if v, err := bob.Get("mine", "b"); err != nil || v != "ZZ" {
+		t.Errorf("invalid import: %s %v", v, err)
+	}
+}
+
+func TestMergeFile(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	write := func(name, contents string, prev string) string {
+		fn := path.Join(dname, name)
+
+		if prev != "" {
+			b, _ := ioutil.ReadFile(prev)
+			_ = ioutil.WriteFile(fn, b, 0644)
+		}
+
+		app.stdin = strings.NewReader(contents)
+		app.args = []string{"-o", fn, "-"}
+
+		seal := SealFileCommand{app}
+
+		if o := seal.Run(); o != 0 {
+			t.Errorf("errors: %s", stderr.String())
+			t.Fatalf("invalid seal return: %d", o)
+		}
+
+		return fn
+	}
+
+	base := write("base", "a=1\nb=2\nc=3\n", "")
+	ours := write("ours", "a=1\nb=22\nc=3\nd=4\n", base)
+	theirs := write("theirs", "a=11\nb=2\ne=5\n", base)
+
+	app.args = []string{base, ours, theirs}
+
+	merge := MergeFileCommand{app}
+
+	if o := merge.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid merge return: %d", o)
+	}
+
+	app.args = []string{ours}
+
+	open := OpenFileCommand{app}
+
+	if o := open.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid open return: %d", o)
+	}
+
+	if s := stdout.String(); s != "a=11\nb=22\nd=4\ne=5\n" {
+		t.Errorf("invalid merge: %q", s)
+	}
+
+	// both sides change the same key
+
+	ours = write("ours", "a=1\nb=22\nc=3\n", base)
+	theirs = write("theirs", "a=1\nb=33\nc=3\n", base)
+
+	stdout.Reset()
+	stderr.Reset()
+	app.args = []string{base, ours, theirs}
+
+	if o := merge.Run(); o != 1 || !strings.Contains(stderr.String(), "conflict on b") {
+		t.Errorf("invalid conflict: %d %s", o, stderr.String())
+	}
+}
+
+func lineOf(b []byte, prefix string) string {
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, prefix) {
+			return l
+		}
+	}
+
+	return ""
+}
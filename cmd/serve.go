@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/matt4biz/envy"
+	"github.com/matt4biz/envy/internal"
+)
+
+type ServeCommand struct {
+	*App
+}
+
+// NeedsDB is false because the server opens the DB for each
+// request; holding it open would lock out other commands.
+func (cmd *ServeCommand) NeedsDB() bool {
+	return false
+}
+
+func (cmd *ServeCommand) Run() int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8200", "loopback address or unix:path")
+	tokens := fs.String("tokens", "", "token file (JSON)")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	if *tokens == "" {
+		cmd.usage()
+		return 1
+	}
+
+	tl, err := loadTokens(*tokens)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "serve: %s\n", err)
+		return -1
+	}
+
+	l, err := listenLocal(*addr)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "serve: %s\n", err)
+		return -1
+	}
+
+	open := func(ctx context.Context) (*envy.Envy, func(), error) {
+		e, err := envy.OpenContext(ctx, "")
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return e, e.Close, nil
+	}
+
+	s := NewServer(open, tl, log.New(cmd.stderr, "", log.LstdFlags))
+	hs := &http.Server{Handler: s}
+	done := make(chan os.Signal, 1)
+
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-done
+		hs.Close()
+	}()
+
+	fmt.Fprintf(cmd.stderr, "serving on %s\n", l.Addr())
+
+	if err := hs.Serve(l); err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(cmd.stderr, "serve: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+// listenLocal only allows a Unix socket or a loopback address,
+// since the API hands out secrets to anyone with a token.
+func listenLocal(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return internal.ListenUnix(strings.TrimPrefix(addr, "unix:"))
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s: not a loopback address", addr)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// Token is a bearer token allowed to use the API, limited
+// to the listed realms ("*" allows all of them).
+type Token struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Realms []string `json:"realms"`
+}
+
+func (t Token) allows(realm string) bool {
+	for _, r := range t.Realms {
+		if r == "*" || r == realm {
+			return true
+		}
+	}
+
+	return false
+}
+
+func loadTokens(fpath string) ([]Token, error) {
+	b, err := ioutil.ReadFile(fpath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tl []Token
+
+	if err = json.Unmarshal(b, &tl); err != nil {
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+
+	for _, t := range tl {
+		if t.Token == "" {
+			return nil, fmt.Errorf("%s: token %q is empty", fpath, t.Name)
+		}
+	}
+
+	return tl, nil
+}
+
+var (
+	errNoToken    = errors.New("missing or invalid token")
+	errForbidden  = errors.New("permission denied")
+	errBadPath    = errors.New("invalid path")
+	errBadMethod  = errors.New("unsupported method")
+	errBadRequest = errors.New("invalid request body")
+)
+
+// Server exposes the store as a JSON API, in a native form under
+// /v1/realms and a Vault KV v2 form under /v1/secret (where each
+// realm is a secret whose data are the realm's key-value pairs).
+type Server struct {
+	open   func(context.Context) (*envy.Envy, func(), error)
+	tokens []Token
+	log    *log.Logger
+}
+
+func NewServer(open func(context.Context) (*envy.Envy, func(), error), tokens []Token, l *log.Logger) *Server {
+	return &Server{open: open, tokens: tokens, log: l}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	name := "-"
+
+	defer func() {
+		s.log.Printf("%s %s %s %d %s", name, r.Method, r.URL.Path, rw.status, time.Since(start))
+	}()
+
+	t, ok := s.authorize(r)
+
+	if !ok {
+		writeError(rw, http.StatusUnauthorized, errNoToken)
+		return
+	}
+
+	name = t.Name
+
+	e, release, err := s.open(r.Context())
+
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	defer release()
+
+	switch p := r.URL.Path; {
+	case strings.HasPrefix(p, "/v1/realms"):
+		s.native(rw, r, e, t, strings.TrimPrefix(p, "/v1/realms"))
+	case strings.HasPrefix(p, "/v1/secret/"):
+		s.vault(rw, r, e, t, strings.TrimPrefix(p, "/v1/secret/"))
+	default:
+		writeError(rw, http.StatusNotFound, errBadPath)
+	}
+}
+
+func (s *Server) authorize(r *http.Request) (Token, bool) {
+	v := r.Header.Get("X-Vault-Token")
+
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		v = strings.TrimPrefix(h, "Bearer ")
+	}
+
+	if v == "" {
+		return Token{}, false
+	}
+
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(v)) == 1 {
+			return t, true
+		}
+	}
+
+	return Token{}, false
+}
+
+// native handles /v1/realms[/realm[/key]].
+func (s *Server) native(w http.ResponseWriter, r *http.Request, e *envy.Envy, t Token, p string) {
+	if p == "" || p == "/" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errBadMethod)
+			return
+		}
+
+		realms, err := e.Realms()
+
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"realms": t.visible(realms)})
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)
+	realm := parts[0]
+
+	if !t.allows(realm) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errBadMethod)
+			return
+		}
+
+		m, err := fetch(r.Context(), e, t, realm)
+
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": m})
+		return
+	}
+
+	key := parts[1]
+
+	switch r.Method {
+	case http.MethodGet:
+		v, err := e.GetWithContext(r.Context(), realm, key, envy.FetchOptions{Allow: t.allows})
+
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"value": v.Data})
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Value *string `json:"value"`
+		}
+
+		if err := readJSON(r.Body, &body); err != nil || body.Value == nil {
+			writeError(w, http.StatusBadRequest, errBadRequest)
+			return
+		}
+
+		if err := e.Set(realm, key, *body.Value); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		// there's no one to confirm it with
+
+		if ok, err := e.Protected(realm); err != nil || ok {
+			if err == nil {
+				err = fmt.Errorf("%s: %w", realm, envy.ErrProtected)
+			}
+
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		if err := e.Drop(realm, key); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errBadMethod)
+	}
+}
+
+// vault handles the KV v2 layout for a mount named "secret":
+// data/<realm> reads or writes a realm, and metadata/ lists
+// the realms.
+func (s *Server) vault(w http.ResponseWriter, r *http.Request, e *envy.Envy, t Token, p string) {
+	switch {
+	case p == "metadata" || p == "metadata/":
+		if r.Method != "LIST" && !(r.Method == http.MethodGet && r.URL.Query().Get("list") == "true") {
+			writeError(w, http.StatusMethodNotAllowed, errBadMethod)
+			return
+		}
+
+		realms, err := e.Realms()
+
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, vaultResponse(map[string]interface{}{"keys": t.visible(realms)}))
+
+	case strings.HasPrefix(p, "data/"):
+		realm := strings.TrimPrefix(p, "data/")
+
+		if realm == "" {
+			writeError(w, http.StatusNotFound, errBadPath)
+			return
+		}
+
+		if !t.allows(realm) {
+			writeError(w, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		s.vaultData(w, r, e, t, realm)
+
+	default:
+		writeError(w, http.StatusNotFound, errBadPath)
+	}
+}
+
+func (s *Server) vaultData(w http.ResponseWriter, r *http.Request, e *envy.Envy, t Token, realm string) {
+	meta := map[string]interface{}{
+		"created_time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"deletion_time": "",
+		"destroyed":     false,
+		"version":       1,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		m, err := fetch(r.Context(), e, t, realm)
+
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, vaultResponse(map[string]interface{}{"data": m, "metadata": meta}))
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+
+		if err := readJSON(r.Body, &body); err != nil || body.Data == nil {
+			writeError(w, http.StatusBadRequest, errBadRequest)
+			return
+		}
+
+		// a write is a new version of the whole secret, so keys
+		// that aren't in it are dropped, which (as for DELETE)
+		// there's no one to confirm for a protected realm
+
+		if ok, err := e.Protected(realm); err != nil || ok {
+			if err == nil {
+				err = fmt.Errorf("%s: %w", realm, envy.ErrProtected)
+			}
+
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		vals := make(map[string]envy.Value, len(body.Data))
+
+		for k, v := range body.Data {
+			vals[k] = envy.Value{Data: v}
+		}
+
+		if err := e.AddValuesWith(realm, vals, envy.AddOptions{Replace: true}); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, vaultResponse(meta))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errBadMethod)
+	}
+}
+
+func (t Token) visible(realms []string) []string {
+	result := make([]string, 0, len(realms))
+
+	for _, r := range realms {
+		if t.allows(r) {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+func vaultResponse(data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"request_id":     "",
+		"lease_id":       "",
+		"renewable":      false,
+		"lease_duration": 0,
+		"data":           data,
+		"wrap_info":      nil,
+		"warnings":       nil,
+		"auth":           nil,
+	}
+}
+
+// fetch reads a realm for a token, whose values may only refer
+// to realms the token allows.
+func fetch(ctx context.Context, e *envy.Envy, t Token, realm string) (map[string]string, error) {
+	m, err := e.FetchWithContext(ctx, realm, envy.FetchOptions{Allow: t.allows})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(m))
+
+	for k, v := range m {
+		result[k] = v.Data
+	}
+
+	return result, nil
+}
+
+func statusFor(err error) int {
+	if errors.Is(err, internal.ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, envy.ErrProtected) || errors.Is(err, envy.ErrNotAllowed) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+func readJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(io.LimitReader(r, 1<<20)).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError uses Vault's error format for both layouts.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string][]string{"errors": {err.Error()}})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/matt4biz/envy"
+)
+
+type serveTest struct {
+	name   string
+	method string
+	path   string
+	token  string
+	body   string
+	status int
+	result string
+}
+
+func TestServe(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("dev", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err := app.Add("prod", map[string]string{"a": "ZZ"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	tokens := []Token{
+		{Name: "all", Token: "t0", Realms: []string{"*"}},
+		{Name: "dev", Token: "t1", Realms: []string{"dev"}},
+	}
+
+	open := func(context.Context) (*envy.Envy, func(), error) {
+		return app.Envy, func() {}, nil
+	}
+
+	logs := new(bytes.Buffer)
+	ts := httptest.NewServer(NewServer(open, tokens, log.New(logs, "", 0)))
+
+	defer ts.Close()
+
+	table := []serveTest{
+		{"no-token", "GET", "/v1/realms", "", "", 401, ""},
+		{"bad-token", "GET", "/v1/realms", "tx", "", 401, ""},
+		{"realms", "GET", "/v1/realms", "t0", "", 200, `{"realms":["dev","prod"]}`},
+		{"realms-scoped", "GET", "/v1/realms", "t1", "", 200, `{"realms":["dev"]}`},
+		{"fetch", "GET", "/v1/realms/dev", "t1", "", 200, `{"data":{"a":"XX","b":"YY"}}`},
+		{"fetch-forbidden", "GET", "/v1/realms/prod", "t1", "", 403, ""},
+		{"get", "GET", "/v1/realms/dev/a", "t1", "", 200, `{"value":"XX"}`},
+		{"get-missing", "GET", "/v1/realms/dev/c", "t1", "", 404, ""},
+		{"set", "PUT", "/v1/realms/dev/c", "t1", `{"value":"WW"}`, 204, ""},
+		{"get-set", "GET", "/v1/realms/dev/c", "t1", "", 200, `{"value":"WW"}`},
+		{"set-bad", "PUT", "/v1/realms/dev/c", "t1", `{"val":"WW"}`, 400, ""},
+		{"drop", "DELETE", "/v1/realms/dev/c", "t1", "", 204, ""},
+		{"vault-list", "LIST", "/v1/secret/metadata/", "t1", "", 200, ""},
+		{"vault-read", "GET", "/v1/secret/data/prod", "t0", "", 200, ""},
+		{"vault-write", "POST", "/v1/secret/data/qa", "t0", `{"data":{"q":"1"}}`, 200, ""},
+		{"vault-forbidden", "POST", "/v1/secret/data/qa", "t1", `{"data":{"q":"1"}}`, 403, ""},
+		{"vault-replace", "PUT", "/v1/secret/data/dev", "t1", `{"data":{"a":"XY","c":"WW"}}`, 200, ""},
+		{"vault-replaced", "GET", "/v1/realms/dev", "t1", "", 200, `{"data":{"a":"XY","c":"WW"}}`},
+	}
+
+	for _, st := range table {
+		req, _ := http.NewRequest(st.method, ts.URL+st.path, strings.NewReader(st.body))
+
+		if st.token != "" {
+			req.Header.Set("Authorization", "Bearer "+st.token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(st.name, err)
+		}
+
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != st.status {
+			t.Errorf("%s: invalid status %d: %s", st.name, resp.StatusCode, b)
+		} else if st.result != "" && strings.TrimSpace(string(b)) != st.result {
+			t.Errorf("%s: invalid result %s", st.name, b)
+		}
+	}
+
+	if v, err := app.Get("qa", "q"); err != nil || v != "1" {
+		t.Errorf("vault write failed: %s %v", v, err)
+	}
+
+	// the keys it replaced went to the trash
+
+	if items, err := app.Trash(); err != nil || len(items) != 2 || items[1].Realm != "dev" || len(items[1].Keys) != 2 {
+		t.Errorf("invalid trash: %v %v", items, err)
+	}
+
+	if err := app.Protect("qa", []byte("pass")); err != nil {
+		t.Fatal("protect", err)
+	}
+
+	preq, _ := http.NewRequest("PUT", ts.URL+"/v1/secret/data/qa", strings.NewReader(`{"data":{"r":"2"}}`))
+	preq.Header.Set("X-Vault-Token", "t0")
+
+	if resp, err := http.DefaultClient.Do(preq); err != nil {
+		t.Fatal("vault protected", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("replaced protected realm: %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/v1/secret/data/dev", nil)
+	req.Header.Set("X-Vault-Token", "t1")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal("vault", err)
+	}
+
+	defer resp.Body.Close()
+
+	var vr struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		t.Fatal("vault decode", err)
+	} else if _, ok := vr.Data.Data["b"]; ok || vr.Data.Data["a"] != "XY" {
+		t.Errorf("invalid vault data: %#v", vr)
+	}
+
+	if !strings.Contains(logs.String(), "dev GET /v1/realms/dev/a 200") {
+		t.Errorf("invalid log: %s", logs.String())
+	}
+}
+
+func TestListenLocal(t *testing.T) {
+	if _, err := listenLocal("0.0.0.0:0"); err == nil {
+		t.Errorf("listening on a public address")
+	}
+
+	l, err := listenLocal("127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("loopback", err)
+	}
+
+	l.Close()
+
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	// a file that isn't a socket is left alone
+
+	fpath := path.Join(dname, "file")
+
+	if err = ioutil.WriteFile(fpath, []byte("data"), 0600); err != nil {
+		t.Fatal("write", err)
+	}
+
+	if _, err = listenLocal("unix:" + fpath); err == nil {
+		t.Errorf("listening in place of a file")
+	}
+
+	if b, err := ioutil.ReadFile(fpath); err != nil || string(b) != "data" {
+		t.Errorf("file removed: %s %v", b, err)
+	}
+
+	sock := path.Join(dname, "serve.sock")
+
+	if l, err = listenLocal("unix:" + sock); err != nil {
+		t.Fatal("unix", err)
+	}
+
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("invalid socket: %v %v", fi, err)
+	}
+
+	// nor is a live socket, but a stale one is replaced
+
+	if _, err = listenLocal("unix:" + sock); err == nil {
+		t.Errorf("listening on a live socket")
+	}
+
+	if ul, ok := l.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+
+	l.Close()
+
+	if l, err = listenLocal("unix:" + sock); err != nil {
+		t.Fatal("unix stale", err)
+	}
+
+	l.Close()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+type ShareCommand struct {
+	*App
+}
+
+// recipients collects repeated -to flags, each of which
+// is a public key or a file holding one.
+type recipients []string
+
+func (r *recipients) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *recipients) Set(s string) error {
+	if !strings.HasPrefix(s, "envy-x25519:") {
+		b, err := ioutil.ReadFile(s)
+
+		if err != nil {
+			return err
+		}
+
+		s = strings.TrimSpace(string(b))
+	}
+
+	*r = append(*r, s)
+	return nil
+}
+
+// parseInterspersed allows flags after the positional
+// arguments, e.g., "share realm -to a.pub -to b.pub".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	result := make([]string, 0, len(args))
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if fs.NArg() == 0 {
+			return result, nil
+		}
+
+		result = append(result, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func (cmd *ShareCommand) Run() int {
+	var to recipients
+
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	self := fs.Bool("self", false, "also share with yourself")
+
+	fs.Var(&to, "to", "recipient's public key (or a file with it)")
+	fs.Usage = cmd.usage
+
+	args, err := parseInterspersed(fs, cmd.args)
+
+	if err != nil || len(args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	if *self {
+		k, err := cmd.PublicKey()
+
+		if err != nil {
+			fmt.Fprintf(cmd.stderr, "share: %s\n", err)
+			return -1
+		}
+
+		to = append(to, k)
+	}
+
+	if err := cmd.unlock(args[0]); err != nil {
+		fmt.Fprintf(cmd.stderr, "share: %s\n", err)
+		return -1
+	}
+
+	if err := cmd.Share(cmd.stdout, args[0], to); err != nil {
+		fmt.Fprintf(cmd.stderr, "share: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
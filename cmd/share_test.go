@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestShareReceive(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	alice := NewTestApp(t, stdout, stderr)
+	bob := NewTestApp(t, stdout, stderr)
+
+	if err := alice.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	pubkey := PubkeyCommand{bob}
+
+	if o := pubkey.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid pubkey return: %d", o)
+	}
+
+	bobKey := strings.TrimSpace(stdout.String())
+	fname := path.Join(dname, "bob.pub")
+
+	if err := ioutil.WriteFile(fname, []byte(bobKey+"\n"), 0600); err != nil {
+		t.Fatal("write pubkey", err)
+	}
+
+	if k, err := bob.PublicKey(); err != nil || k != bobKey {
+		t.Errorf("pubkey changed: %s %v", k, err)
+	}
+
+	stdout.Reset()
+	alice.args = []string{"top", "--to", fname}
+
+	share := ShareCommand{alice}
+
+	if o := share.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid share return: %d", o)
+	}
+
+	shared := stdout.String()
+
+	if strings.Contains(shared, `"XX"`) {
+		t.Errorf("plaintext in shared file: %s", shared)
+	}
+
+	stdout.Reset()
+	bob.stdin = strings.NewReader(shared)
+	bob.args = []string{"-realm", "theirs", "-"}
+
+	receive := ReceiveCommand{bob}
+
+	if o := receive.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid receive return: %d", o)
+	}
+
+	if s := stdout.String(); s != "+ theirs/a\n+ theirs/b\n" {
+		t.Errorf("invalid receive output: %q", s)
+	}
+
+	if m, err := bob.Fetch("theirs"); err != nil || m["a"] != "XX" || m["b"] != "YY" {
+		t.Errorf("invalid received realm: %v %v", m, err)
+	}
+
+	// receiving into a realm that exists needs confirmation,
+	// which can't come from stdin when the share does
+
+	stdout.Reset()
+	stderr.Reset()
+	bob.stdin = strings.NewReader(shared)
+	bob.args = []string{"-realm", "theirs", "-"}
+
+	if o := receive.Run(); o != 1 || !strings.Contains(stderr.String(), "share is for theirs") {
+		t.Errorf("invalid unconfirmed receive: %d %s", o, stderr.String())
+	}
+
+	bob.stdin = strings.NewReader(shared)
+	bob.args = []string{"-realm", "theirs", "-yes", "-"}
+
+	if o := receive.Run(); o != 0 {
+		t.Errorf("errors: %s", stderr.String())
+		t.Fatalf("invalid confirmed receive return: %d", o)
+	}
+
+	if s := stdout.String(); s != "= theirs/a\n= theirs/b\n" {
+		t.Errorf("invalid confirmed receive output: %q", s)
+	}
+
+	// alice didn't share with herself
+
+	stderr.Reset()
+	alice.stdin = strings.NewReader(shared)
+	alice.args = []string{"-"}
+
+	receive = ReceiveCommand{alice}
+
+	if o := receive.Run(); o != -1 || !strings.Contains(stderr.String(), "not encrypted to this user's key") {
+		t.Errorf("invalid 2nd receive: %d %s", o, stderr.String())
+	}
+
+	alice.args = []string{"top"}
+
+	if o := share.Run(); o != -1 {
+		t.Errorf("share with no recipients: %d", o)
+	}
+}
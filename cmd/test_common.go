@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -34,6 +35,7 @@ func NewTestApp(t *testing.T, so, se *bytes.Buffer) *App {
 
 	app := App{
 		Envy:   e,
+		ctx:    context.Background(),
 		args:   []string{},
 		stdout: so,
 		stderr: se,
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+type TrashCommand struct {
+	*App
+}
+
+func (cmd *TrashCommand) Run() int {
+	if len(cmd.args) < 1 {
+		cmd.usage()
+		return 1
+	}
+
+	switch cmd.args[0] {
+	case "list":
+		return cmd.list()
+	case "empty":
+		return cmd.empty()
+	}
+
+	cmd.usage()
+	return 1
+}
+
+func (cmd *TrashCommand) list() int {
+	items, err := cmd.Trash()
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "trash: %s\n", err)
+		return -1
+	}
+
+	for _, t := range items {
+		name, what := t.Realm, fmt.Sprintf("%d key(s)", len(t.Keys))
+
+		if t.Key != "" {
+			name, what = t.Realm+"/"+t.Key, "key"
+		}
+
+		fmt.Fprintf(cmd.stdout, "%s   %s  %s  %s\n", name, t.Dropped.Format(time.RFC3339), what, internal.DaysLeft(t.Expires))
+	}
+
+	return 0
+}
+
+func (cmd *TrashCommand) empty() int {
+	fs := flag.NewFlagSet("trash empty", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args[1:]); err != nil {
+		cmd.usage()
+		return 1
+	}
+
+	if !*yes && !cmd.confirm("empty the trash? this can't be undone") {
+		return 1
+	}
+
+	if _, err := cmd.EmptyTrash(); err != nil {
+		fmt.Fprintf(cmd.stderr, "trash: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
+
+type RestoreTrashCommand struct {
+	*App
+}
+
+func (cmd *RestoreTrashCommand) Run() int {
+	if len(cmd.args) != 1 {
+		cmd.usage()
+		return 1
+	}
+
+	parts := strings.SplitN(cmd.args[0], "/", 2)
+	key := ""
+
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+
+	if err := cmd.RestoreTrash(parts[0], key); err != nil {
+		fmt.Fprintf(cmd.stderr, "restore-trash: %s\n", err)
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTrash(t *testing.T) { //nolint:gocyclo
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	if err := app.Add("top", map[string]string{"a": "XX", "b": "YY"}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	app.args = []string{"top/a"}
+
+	if o := (&DropCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid drop return: %d: %s", o, stderr.String())
+	}
+
+	app.args = []string{"list"}
+
+	if o := (&TrashCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid list return: %d: %s", o, stderr.String())
+	}
+
+	if s := stdout.String(); !strings.HasPrefix(s, "top/a   ") || !strings.Contains(s, "30d left") {
+		t.Errorf("invalid list: %q", s)
+	}
+
+	app.args = []string{"top/a"}
+
+	if o := (&RestoreTrashCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid restore return: %d: %s", o, stderr.String())
+	}
+
+	if v, err := app.Get("top", "a"); err != nil || v != "XX" {
+		t.Errorf("invalid restored key: %s %v", v, err)
+	}
+
+	app.args = []string{"top/a"}
+
+	if o := (&RestoreTrashCommand{app}).Run(); o != -1 {
+		t.Errorf("invalid 2nd restore return: %d", o)
+	}
+
+	app.args = []string{"top"}
+
+	if o := (&DropCommand{app}).Run(); o != 0 {
+		t.Fatalf("invalid purge return: %d: %s", o, stderr.String())
+	}
+
+	app.stdin = strings.NewReader("n\n")
+	app.args = []string{"empty"}
+
+	if o := (&TrashCommand{app}).Run(); o != 1 {
+		t.Errorf("invalid empty return when refused: %d", o)
+	}
+
+	app.args = []string{"empty", "-yes"}
+
+	if o := (&TrashCommand{app}).Run(); o != 0 {
+		t.Errorf("invalid empty return: %d: %s", o, stderr.String())
+	}
+
+	app.args = []string{"top"}
+
+	if o := (&RestoreTrashCommand{app}).Run(); o != -1 {
+		t.Errorf("invalid restore return after empty: %d", o)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/matt4biz/envy"
+)
+
+type WatchCommand struct {
+	*App
+}
+
+func (cmd *WatchCommand) Run() int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", envy.DefaultWatchInterval, "how often to check for changes")
+	hook := fs.String("hook", "", "shell command to run on each change")
+
+	fs.Usage = cmd.usage
+
+	if err := fs.Parse(cmd.args); err != nil || fs.NArg() == 0 {
+		cmd.usage()
+		return 1
+	}
+
+	ch, err := cmd.WatchWith(cmd.ctx, envy.WatchOptions{Interval: *interval}, fs.Args()...)
+
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "watch: %s\n", err)
+		return -1
+	}
+
+	// let other commands make changes
+
+	if err = cmd.Suspend(); err != nil {
+		fmt.Fprintf(cmd.stderr, "watch: %s\n", err)
+		return -1
+	}
+
+	for c := range ch {
+		cmd.report(c, *hook)
+	}
+
+	return 0
+}
+
+// report prints a change, or runs the hook for it with the
+// change in its environment; a hook that fails is reported,
+// but doesn't stop the watch.
+func (cmd *WatchCommand) report(c envy.Event, hook string) {
+	if hook == "" {
+		fmt.Fprintf(cmd.stdout, "%s %-7s %s/%s\n", time.Now().Format(time.RFC3339), c.Kind, c.Realm, c.Key)
+		return
+	}
+
+	sub := exec.Command("/bin/sh", "-c", hook)
+
+	sub.Stdout = cmd.stdout
+	sub.Stderr = cmd.stderr
+	sub.Env = append(os.Environ(),
+		"ENVY_CHANGE_REALM="+c.Realm,
+		"ENVY_CHANGE_KEY="+c.Key,
+		"ENVY_CHANGE_KIND="+string(c.Kind),
+	)
+
+	if err := sub.Run(); err != nil {
+		fmt.Fprintf(cmd.stderr, "watch: hook for %s/%s: %s\n", c.Realm, c.Key, err)
+	}
+}
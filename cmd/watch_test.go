@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matt4biz/envy"
+)
+
+func TestWatchReport(t *testing.T) {
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+	cmd := WatchCommand{app}
+	ev := envy.Event{Realm: "dev", Key: "TOKEN", Kind: envy.KeyChanged}
+
+	cmd.report(ev, "")
+
+	if s := stdout.String(); !strings.HasSuffix(s, " changed dev/TOKEN\n") {
+		t.Errorf("invalid output: %q", s)
+	}
+
+	fname := filepath.Join(dname, "hook.out")
+
+	cmd.report(ev, `echo "$ENVY_CHANGE_KIND $ENVY_CHANGE_REALM/$ENVY_CHANGE_KEY" > `+fname)
+
+	if b, err := ioutil.ReadFile(fname); err != nil || string(b) != "changed dev/TOKEN\n" {
+		t.Errorf("invalid hook output: %q %v", b, err)
+	}
+
+	stderr.Reset()
+	cmd.report(ev, "exit 3")
+
+	if s := stderr.String(); !strings.Contains(s, "hook for dev/TOKEN") {
+		t.Errorf("invalid error: %q", s)
+	}
+}
+
+func TestWatchUsage(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+	cmd := WatchCommand{app}
+
+	if o := cmd.Run(); o != 1 {
+		t.Errorf("invalid return without realms: %d", o)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+
+	"github.com/matt4biz/envy"
 )
 
 type WriteCommand struct {
@@ -13,6 +15,9 @@ type WriteCommand struct {
 func (cmd *WriteCommand) Run() int {
 	fs := flag.NewFlagSet("list", flag.ContinueOnError)
 	clear := fs.Bool("clear", false, "overwrite contents")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	flatten := fs.String("flatten", "", "flatten nested keys: dot, env, or a separator")
+	asYAML := fs.Bool("yaml", false, "read YAML")
 
 	fs.Usage = cmd.usage
 
@@ -44,13 +49,26 @@ func (cmd *WriteCommand) Run() int {
 	}
 
 	if *clear {
-		if err := cmd.Purge(cmd.args[0]); err != nil {
+		ok, err := cmd.confirmDestroy(cmd.args[0], "clear it", *yes)
+
+		if err != nil {
 			fmt.Fprintf(cmd.stderr, "read: %s\n", err)
 			return -1
+		} else if !ok {
+			return 1
 		}
 	}
 
-	err := cmd.Read(reader, cmd.args[0])
+	// the realm's cleared only once the input's been read
+
+	opts := envy.ReadOptions{YAML: *asYAML || isYAML(cmd.args[1]), Replace: *clear}
+
+	if *flatten != "" {
+		f := envy.ParseFlattening(*flatten)
+		opts.Flatten = &f
+	}
+
+	err := cmd.ReadWith(reader, cmd.args[0], opts)
 
 	if err != nil {
 		fmt.Fprintf(cmd.stderr, "read: %s\n", err)
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path"
 	"reflect"
 	"testing"
+
+	"github.com/matt4biz/envy"
 )
 
 func TestWrite(t *testing.T) {
@@ -66,10 +69,24 @@ func TestOverwrite(t *testing.T) {
 		t.Fatal("setup", err)
 	}
 
-	app.stdin = bytes.NewBufferString(`{"x":"21", "y":"14"}`)
+	// bad input leaves the realm as it was
+
+	app.stdin = bytes.NewBufferString(`{"x":"21", "y":`)
 	app.args = []string{"-clear", "test", "-"}
 
 	cmd := WriteCommand{app}
+
+	if o := cmd.Run(); o != -1 {
+		t.Errorf("invalid return for bad input: %d", o)
+	}
+
+	if m, err := cmd.Fetch("test"); err != nil || !reflect.DeepEqual(m, data) {
+		t.Errorf("realm changed by bad input: %v %v", m, err)
+	}
+
+	app.stdin = bytes.NewBufferString(`{"x":"21", "y":"14"}`)
+	app.args = []string{"-clear", "test", "-"}
+
 	o := cmd.Run()
 
 	if o != 0 {
@@ -89,3 +106,59 @@ func TestOverwrite(t *testing.T) {
 		t.Errorf("invalid values: %#v", m)
 	}
 }
+
+func TestReadWriteTyped(t *testing.T) {
+	dname, err := ioutil.TempDir("", "scratch")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	app := NewTestApp(t, stdout, stderr)
+
+	file := envy.BinaryValue([]byte("-----BEGIN-----\n"))
+	file.Type = envy.TypeFile
+
+	vals := map[string]envy.Value{
+		"DB__KEY":  envy.BinaryValue([]byte{0, 1, 2, 0xff}),
+		"DB__CERT": file,
+		"OTP":      {Data: "JBSWY3DPEHPK3PXP", Type: envy.TypeTOTP},
+		"PORT":     {Data: "5432", Type: envy.TypeNumber},
+		"NAME":     {Data: "app"},
+	}
+
+	if err = app.AddValues("top", vals); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	// binary & file values (and others whose type JSON can't
+	// show) keep their type, also when nested
+
+	for _, args := range [][]string{{"x.json"}, {"-nest", "env", "x.yaml"}} {
+		fname := path.Join(dname, args[len(args)-1])
+
+		app.args = append(append([]string{}, args[:len(args)-1]...), "top", fname)
+
+		if o := (&ReadCommand{app}).Run(); o != 0 {
+			t.Fatalf("invalid read return: %d: %s", o, stderr.String())
+		}
+
+		app.args = []string{"copy", fname}
+
+		if len(args) > 1 {
+			app.args = append([]string{"-clear", "-flatten", "env"}, app.args...)
+		}
+
+		if o := (&WriteCommand{app}).Run(); o != 0 {
+			t.Fatalf("invalid write return: %d: %s", o, stderr.String())
+		}
+
+		if m, err := app.FetchValues("copy"); err != nil || !reflect.DeepEqual(m, vals) {
+			t.Errorf("invalid values from %s: %v %v", fname, m, err)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package envy
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NestSep joins the key prefix of a nested struct to the
+// keys of its fields, as for EnvKeys.
+const NestSep = "__"
+
+var (
+	ErrNotStruct   = errors.New("can only unmarshal into a pointer to a struct")
+	ErrMissing     = errors.New("required key is missing")
+	ErrUnsupported = errors.New("unsupported field type")
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FieldError is a struct field that couldn't be filled.
+type FieldError struct {
+	Field string // the path of the field, e.g., DB.Port
+	Key   string
+	Err   error
+}
+
+func (f FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", f.Field, f.Key, f.Err)
+}
+
+func (f FieldError) Unwrap() error {
+	return f.Err
+}
+
+// UnmarshalError lists every field that was missing or
+// whose value couldn't be converted.
+type UnmarshalError struct {
+	Realm  string
+	Fields []FieldError
+}
+
+func (u *UnmarshalError) Error() string {
+	s := make([]string, len(u.Fields))
+
+	for i, f := range u.Fields {
+		s[i] = f.Error()
+	}
+
+	return fmt.Sprintf("%s: %d invalid field(s): %s", u.Realm, len(u.Fields), strings.Join(s, "; "))
+}
+
+// Unmarshal fills the struct pointed to by v from the (resolved)
+// values of the realm, by the keys in the fields' tags:
+//
+//	Port    int           `envy:"PORT,default=8080"`
+//	Token   string        `envy:"TOKEN,required"`
+//	Timeout time.Duration `envy:"TIMEOUT"`
+//	DB      struct{...}   `envy:"DB"`
+//
+// Strings, bools, numbers, durations, byte slices (from binary
+// values), slices (of a JSON array, or else comma-separated) and
+// any encoding.TextUnmarshaler are converted; the fields of a nested
+// struct use keys prefixed by its own key and NestSep (DB__HOST),
+// or no prefix if it has no tag. Untagged fields are left alone.
+//
+// A required key must be present (even if empty), and a default
+// is used only if the key isn't. All the fields that are missing
+// or invalid are reported together in an *UnmarshalError.
+func (e *Envy) Unmarshal(realm string, v interface{}) error {
+	return e.UnmarshalContext(context.Background(), realm, v)
+}
+
+// UnmarshalContext is like Unmarshal, but stops if ctx is done.
+func (e *Envy) UnmarshalContext(ctx context.Context, realm string, v interface{}) error {
+	vals, err := e.FetchWithContext(ctx, realm, FetchOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalValues(realm, vals, v)
+}
+
+// UnmarshalValues is like Unmarshal, with values already
+// fetched; the realm is only used to report errors.
+func UnmarshalValues(realm string, vals map[string]Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrNotStruct
+	}
+
+	d := decoder{vals: vals}
+	d.decodeStruct(rv.Elem(), "", "")
+
+	if len(d.errs) > 0 {
+		return &UnmarshalError{Realm: realm, Fields: d.errs}
+	}
+
+	return nil
+}
+
+type decoder struct {
+	vals map[string]Value
+	errs []FieldError
+}
+
+type fieldTag struct {
+	key      string
+	required bool
+	dflt     *string
+}
+
+// parseTag splits KEY,required,default=...; the default
+// takes the rest of the tag, so it may contain commas.
+func parseTag(tag string) fieldTag {
+	parts := strings.Split(tag, ",")
+	ft := fieldTag{key: parts[0]}
+
+	for i, p := range parts[1:] {
+		if p == "required" {
+			ft.required = true
+		} else if strings.HasPrefix(p, "default=") {
+			d := strings.Join(parts[i+1:], ",")[len("default="):]
+			ft.dflt = &d
+			break
+		}
+	}
+
+	return ft
+}
+
+func (d *decoder) decodeStruct(sv reflect.Value, path, prefix string) {
+	st := sv.Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+
+		if sf.PkgPath != "" && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue // unexported, unless an embedded struct
+		}
+
+		tag, tagged := sf.Tag.Lookup("envy")
+
+		if tag == "-" {
+			continue
+		}
+
+		fv := sv.Field(i)
+		name := sf.Name
+
+		if path != "" {
+			name = path + "." + name
+		}
+
+		ft := parseTag(tag)
+
+		if isNested(fv.Type()) {
+			sub := prefix
+
+			if ft.key != "" {
+				sub = prefix + ft.key + NestSep
+			}
+
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+
+				fv = fv.Elem()
+			}
+
+			d.decodeStruct(fv, name, sub)
+			continue
+		}
+
+		if !tagged || ft.key == "" {
+			continue
+		}
+
+		key := prefix + ft.key
+		val, ok := d.vals[key]
+
+		if !ok {
+			if ft.required {
+				d.errs = append(d.errs, FieldError{name, key, ErrMissing})
+				continue
+			}
+
+			if ft.dflt == nil {
+				continue
+			}
+
+			val = Value{Data: *ft.dflt}
+		}
+
+		if err := setField(fv, val); err != nil {
+			d.errs = append(d.errs, FieldError{name, key, err})
+		}
+	}
+}
+
+// isNested reports whether a field is a struct (or a pointer
+// to one) to fill field by field, rather than from one value.
+func isNested(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func setField(fv reflect.Value, val Value) error {
+	if fv.Kind() == reflect.Ptr {
+		nv := reflect.New(fv.Type().Elem())
+
+		if err := setField(nv.Elem(), val); err != nil {
+			return err
+		}
+
+		fv.Set(nv)
+		return nil
+	}
+
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		b, err := val.Bytes()
+
+		if err != nil {
+			return err
+		}
+
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+
+	if fv.Type() == durationType {
+		dur, err := time.ParseDuration(val.Data)
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(int64(dur))
+		return nil
+	}
+
+	if fv.Kind() == reflect.Slice {
+		return setSlice(fv, val)
+	}
+
+	return setScalar(fv, val.Data)
+}
+
+func setScalar(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("%s: %w", fv.Type(), ErrUnsupported)
+	}
+
+	return nil
+}
+
+// setSlice fills a byte slice with the value's bytes, and
+// any other slice from a JSON array or a comma-separated list.
+func setSlice(fv reflect.Value, val Value) error {
+	if fv.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := val.Bytes()
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetBytes(b)
+		return nil
+	}
+
+	items, err := sliceItems(val)
+
+	if err != nil {
+		return err
+	}
+
+	sv := reflect.MakeSlice(fv.Type(), len(items), len(items))
+
+	for i, item := range items {
+		if err := setField(sv.Index(i), Value{Data: item}); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+
+	fv.Set(sv)
+	return nil
+}
+
+func sliceItems(val Value) ([]string, error) {
+	s := strings.TrimSpace(val.Data)
+
+	if s == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(s, "[") || !json.Valid([]byte(s)) {
+		items := strings.Split(s, ",")
+
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+
+		return items, nil
+	}
+
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, err
+	}
+
+	items := make([]string, len(raw))
+
+	for i, r := range raw {
+		// strings are unquoted, other items used as they are
+
+		if err := json.Unmarshal(r, &items[i]); err != nil {
+			items[i] = string(r)
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,149 @@
+package envy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Problem is something wrong found by Check, with the realm
+// and key if it's about a particular record.
+type Problem struct {
+	Realm string
+	Key   string
+	Err   error
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Key != "":
+		return fmt.Sprintf("%s/%s: %s", p.Realm, p.Key, p.Err)
+	case p.Realm != "":
+		return fmt.Sprintf("%s: %s", p.Realm, p.Err)
+	}
+
+	return p.Err.Error()
+}
+
+// Unreadable reports whether the problem is a record
+// that can't be decoded or decrypted.
+func (p Problem) Unreadable() bool {
+	return p.Key != ""
+}
+
+var (
+	ErrPermissions = errors.New("insecure permissions")
+	ErrWrongKey    = errors.New("no records can be read; has the secret key in the keyring changed?")
+)
+
+// CheckPermissions looks for a DB directory or file that
+// other users may be able to read.
+func CheckPermissions(dir string) []Problem {
+	result := make([]Problem, 0)
+
+	for _, c := range []struct {
+		fpath string
+		mode  os.FileMode
+	}{
+		{dir, 0700},
+		{path.Join(dir, "envy.db"), 0600},
+	} {
+		fi, err := os.Stat(c.fpath)
+
+		if err != nil {
+			result = append(result, Problem{Err: err})
+			continue
+		}
+
+		if perm := fi.Mode().Perm(); perm&^c.mode != 0 {
+			err = fmt.Errorf("%s has mode %04o, should be %04o: %w", c.fpath, perm, c.mode, ErrPermissions)
+			result = append(result, Problem{Err: err})
+		}
+	}
+
+	return result
+}
+
+// Check looks for problems with the DB: its consistency, any
+// records that can't be decoded or decrypted, and the audit log.
+func (e *Envy) Check() ([]Problem, error) {
+	result := make([]Problem, 0)
+
+	if err := e.db.Check(); err != nil {
+		result = append(result, Problem{Err: fmt.Errorf("database: %w", err)})
+	}
+
+	realms, err := e.db.ListRealms()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var total, bad int
+
+	for _, r := range realms {
+		keys, err := e.db.ListKeys(r)
+
+		if err != nil {
+			result = append(result, Problem{Realm: r, Err: err})
+			continue
+		}
+
+		// if the realm's key can't be read, neither can any of
+		// its records, but there's no use quarantining them
+
+		s, err := e.realmSealer(r, false)
+
+		if err != nil {
+			total += len(keys)
+			bad += len(keys)
+			result = append(result, Problem{Realm: r, Err: err})
+			continue
+		}
+
+		for _, k := range keys {
+			total++
+
+			sd, err := e.db.GetKey(r, k)
+
+			if err != nil {
+				bad++
+				result = append(result, Problem{Realm: r, Key: k, Err: fmt.Errorf("decoding: %w", err)})
+				continue
+			}
+
+			if _, err = s.UnsealFor(r, k, sd); err != nil {
+				bad++
+				result = append(result, Problem{Realm: r, Key: k, Err: fmt.Errorf("unsealing: %w", err)})
+			}
+		}
+	}
+
+	// if nothing can be read, it's the key that's wrong and
+	// not the records, which shouldn't be quarantined
+
+	if total > 0 && bad == total {
+		result = append(result, Problem{Err: ErrWrongKey})
+	}
+
+	if err := e.VerifyAudit(); err != nil {
+		result = append(result, Problem{Err: fmt.Errorf("audit: %w", err)})
+	}
+
+	return result, nil
+}
+
+// Quarantine moves an unreadable record out of its realm.
+func (e *Envy) Quarantine(realm, key string) error {
+	if err := e.db.Quarantine(realm, key); err != nil {
+		return err
+	}
+
+	return e.audit("quarantine", realm, key)
+}
+
+// DefaultDirectory returns where the DB normally lives.
+func DefaultDirectory() (string, error) {
+	return defaultDirectory()
+}
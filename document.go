@@ -0,0 +1,152 @@
+package envy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Flattening is how the keys of a nested document map to
+// the keys of a realm.
+type Flattening struct {
+	Sep   string // joins the keys at each level
+	Upper bool   // keys are upper-cased (and lower-cased to nest them)
+}
+
+var (
+	DotKeys = Flattening{Sep: "."}               // db.host
+	EnvKeys = Flattening{Sep: "__", Upper: true} // DB__HOST
+)
+
+// ParseFlattening takes "dot" or "env", or else a separator
+// to use as it is.
+func ParseFlattening(s string) Flattening {
+	switch s {
+	case "dot":
+		return DotKeys
+	case "env":
+		return EnvKeys
+	}
+
+	return Flattening{Sep: s}
+}
+
+// ReadOptions control how ReadWith takes a document.
+type ReadOptions struct {
+	YAML    bool        // the document is YAML rather than JSON
+	Flatten *Flattening // nested objects become keys, not JSON values
+	Replace bool        // the realm's old contents go to the trash, as with Clear
+}
+
+// ReadWith is like Read, with more options; the document is
+// decoded in full before anything's written, so with Replace,
+// the realm's left as it was if the document's bad.
+func (e *Envy) ReadWith(r io.Reader, realm string, opts ReadOptions) error {
+	b, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+
+	if opts.YAML {
+		doc, err = internal.DecodeYAML(b)
+	} else {
+		doc, err = internal.DecodeJSON(b)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if f := opts.Flatten; f != nil {
+		if doc, err = internal.Flatten(doc, f.Sep, f.Upper); err != nil {
+			return err
+		}
+	}
+
+	vals := make(map[string]Value, len(doc))
+
+	for k, v := range doc {
+		raw, err := json.Marshal(v)
+
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", realm, k, err)
+		}
+
+		if vals[k], err = ValueFromJSON(raw); err != nil {
+			return fmt.Errorf("%s/%s: %w", realm, k, err)
+		}
+	}
+
+	return e.AddValuesWith(realm, vals, AddOptions{Replace: opts.Replace})
+}
+
+// FetchDocument returns the realm as a document of values of
+// their types (as FetchAsJSON would write it), nested by their
+// keys if nest is given. Values whose type JSON can't show, such
+// as binary, are objects with "$type" and "$value", which ReadWith
+// takes back as they were.
+func (e *Envy) FetchDocument(realm string, nest *Flattening) (map[string]interface{}, error) {
+	vals, err := e.FetchValues(realm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := ValuesAsJSON(vals)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := internal.DecodeJSON(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range vals {
+		if v.tagged() {
+			doc[k] = map[string]interface{}{internal.TypeKey: v.Type, internal.ValueKey: v.Data}
+		}
+	}
+
+	if nest == nil {
+		return doc, nil
+	}
+
+	return internal.Nest(doc, nest.Sep, nest.Upper)
+}
+
+// UnquoteJSON replaces strings in the document that hold JSON
+// objects or arrays with what they hold, e.g., for values that
+// were stored as strings before they could be typed.
+func UnquoteJSON(doc map[string]interface{}) {
+	for k, v := range doc {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			UnquoteJSON(x)
+
+		case string:
+			s := bytes.TrimSpace([]byte(x))
+
+			if len(s) == 0 || (s[0] != '{' && s[0] != '[') {
+				continue
+			}
+
+			if inner, err := internal.DecodeJSON([]byte(`{"v":` + string(s) + `}`)); err == nil {
+				if sub, ok := inner["v"].(map[string]interface{}); ok {
+					UnquoteJSON(sub)
+				}
+
+				doc[k] = inner["v"]
+			}
+		}
+	}
+}
@@ -1,13 +1,19 @@
 package envy
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"path"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/matt4biz/envy/internal"
 )
@@ -15,60 +21,197 @@ import (
 // Envy provides the interface to the local secure
 // variable store.
 type Envy struct {
-	db     internal.DB
-	dir    string
-	sealer *internal.Sealer
+	db       internal.DB
+	dir      string
+	sealer   *internal.Sealer
+	unlocked map[string]bool // protected realms that have been unlocked
+
+	mu        sync.Mutex // guards db & suspended for watchers
+	suspended bool
 }
 
 // New returns a secure variable store whose DB
 // lives in the user's "config" directory.
 func New() (*Envy, error) {
-	d, err := defaultDirectory()
+	return OpenContext(context.Background(), "")
+}
 
-	if err != nil {
-		return nil, err
+// OpenContext is like New (or NewWithDirectory, if dir isn't
+// empty), but gives up reading the keychain, or waiting for
+// another process that has the DB open, when ctx is done.
+func OpenContext(ctx context.Context, dir string) (*Envy, error) {
+	if dir == "" {
+		d, err := defaultDirectory()
+
+		if err != nil {
+			return nil, err
+		}
+
+		dir = d
 	}
 
-	s, err := internal.NewDefaultSealer()
+	s, err := internal.NewDefaultSealerContext(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewWithSealer(d, s)
+	return NewWithSealerContext(ctx, dir, s)
 }
 
 // NewWithDirectory returns a secure variable store
 // whose DB lives in the provided directory (mainly
 // for UTs that need a temporary directory).
 func NewWithDirectory(dir string) (*Envy, error) {
-	s, err := internal.NewDefaultSealer()
-
-	if err != nil {
-		return nil, err
-	}
-
-	return NewWithSealer(dir, s)
+	return OpenContext(context.Background(), dir)
 }
 
 // NewWithSealer is really a constructor for UTs, so we
 // can pass in a fake sealer that's deterministic.
 func NewWithSealer(dir string, s *internal.Sealer) (*Envy, error) {
-	db, err := internal.NewBoltDB(path.Join(dir, "/envy.db"))
+	return NewWithSealerContext(context.Background(), dir, s)
+}
+
+// NewWithSealerContext is like NewWithSealer, but gives up
+// waiting for the DB when ctx is done.
+func NewWithSealerContext(ctx context.Context, dir string, s *internal.Sealer) (*Envy, error) {
+	db, s, err := openDB(ctx, dir, s)
 
 	if err != nil {
 		return nil, err
 	}
 
 	e := Envy{
-		db:     db,
-		dir:    dir,
-		sealer: s,
+		db:       db,
+		dir:      dir,
+		sealer:   s,
+		unlocked: make(map[string]bool),
 	}
 
 	return &e, nil
 }
 
+// openDB opens the DB in the directory, with the sealer's
+// name cipher if its names are hidden; it returns the sealer
+// to use, which is Bound if the DB's records have been upgraded.
+func openDB(ctx context.Context, dir string, s *internal.Sealer) (*internal.BoltDB, *internal.Sealer, error) {
+	db, err := internal.NewBoltDBContext(ctx, path.Join(dir, "/envy.db"))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hidden, err := db.NamesHidden()
+
+	if err == nil && hidden {
+		var n *internal.NameCipher
+
+		if n, err = internal.NewNameCipher(s); err == nil {
+			db.UseNames(n)
+		}
+	}
+
+	bound := false
+
+	if err == nil {
+		bound, err = db.IsBound()
+	}
+
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	if bound {
+		s = s.Bound()
+	}
+
+	return db, s, nil
+}
+
+// Suspend closes the DB until Resume, so that other processes
+// (which would otherwise wait for it) may use it meanwhile; a
+// long-running client should suspend while it's idle.
+func (e *Envy) Suspend() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.suspended = true
+	return e.db.Close()
+}
+
+// Resume reopens the DB after Suspend; realms that have been
+// unlocked stay unlocked.
+func (e *Envy) Resume() error {
+	return e.ResumeContext(context.Background())
+}
+
+// ResumeContext is like Resume, but gives up waiting for
+// the DB when ctx is done.
+func (e *Envy) ResumeContext(ctx context.Context) error {
+	db, s, err := openDB(ctx, e.dir, e.sealer)
+
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.db, e.sealer, e.suspended = db, s, false
+	return nil
+}
+
+// Modified returns when the DB file was last changed, to
+// tell whether it needs to be read again after Suspend.
+func (e *Envy) Modified() (time.Time, error) {
+	fi, err := os.Stat(path.Join(e.dir, "envy.db"))
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+// Fingerprint returns a hash of the realms' records as stored
+// (or of every realm, if none are given), which changes with any
+// of their values, but without reading them (or auditing that).
+func (e *Envy) Fingerprint(realms ...string) (string, error) {
+	if len(realms) == 0 {
+		var err error
+
+		if realms, err = e.Realms(); err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+
+	for _, r := range realms {
+		m, err := e.db.GetAllKeys(r)
+
+		if err != nil && !errors.Is(err, internal.ErrNotFound) {
+			return "", err
+		}
+
+		keys := make([]string, 0, len(m))
+
+		for k := range m {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+		fmt.Fprintf(h, "%d:%s/%d\n", len(r), r, len(keys))
+
+		for _, k := range keys {
+			fmt.Fprintf(h, "%d:%s %s %s\n", len(k), k, m[k].Data, m[k].Meta)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // CurrentUser returns the user's login name.
 func (e *Envy) CurrentUser() string {
 	return e.sealer.GetUsername()
@@ -83,11 +226,63 @@ func (e *Envy) Directory() string {
 // store, possibly creating it and/or overwriting variables
 // that are already there.
 func (e *Envy) Add(realm string, vars map[string]string) error {
+	vals := make(map[string]Value, len(vars))
+
+	for k, v := range vars {
+		vals[k] = Value{Data: v}
+	}
+
+	return e.AddValues(realm, vals)
+}
+
+// AddValues is like Add for values of any type.
+func (e *Envy) AddValues(realm string, vars map[string]Value) error {
+	return e.AddValuesWith(realm, vars, AddOptions{})
+}
+
+// AddOptions give values an expiry as they're added, as with
+// SetExpiry, or replace the realm's contents, but in the same
+// transaction.
+type AddOptions struct {
+	Expires time.Time     // a fixed time
+	MaxAge  time.Duration // a rotation period
+	Replace bool          // the realm's old contents go to the trash, as with Clear
+}
+
+// AddValuesWith is like AddValues, with options; if either
+// expiry is given, any max age the keys had is replaced.
+func (e *Envy) AddValuesWith(realm string, vars map[string]Value, opts AddOptions) error {
+	for k, v := range vars {
+		if err := v.check(); err != nil {
+			return fmt.Errorf("%s/%s: %w", realm, k, err)
+		}
+	}
+
+	s, err := e.realmSealer(realm, true)
+
+	if err != nil {
+		return err
+	}
+
 	m := make(internal.Stored)
 
+	expiring := !opts.Expires.IsZero() || opts.MaxAge != 0
+
 	for k, v := range vars {
-		ud := internal.Unsealed{Data: v}
-		sd, err := e.sealer.Seal(ud)
+		v = v.normal()
+		ud := internal.Unsealed{Data: v.Data}
+		ud.Meta.MaxAge = e.maxAge(realm, k)
+		ud.Meta.Type = v.Type
+
+		if expiring {
+			ud.Meta.MaxAge = int64(opts.MaxAge / time.Second)
+
+			if !opts.Expires.IsZero() {
+				ud.Meta.Expires = opts.Expires.Unix()
+			}
+		}
+
+		sd, err := s.SealFor(realm, k, ud)
 
 		if err != nil {
 			return fmt.Errorf("sealing %s/%s: %w", realm, k, err)
@@ -96,7 +291,58 @@ func (e *Envy) Add(realm string, vars map[string]string) error {
 		m[k] = sd
 	}
 
-	return e.db.SetKeys(realm, m)
+	cleared, err := e.setKeys(realm, m, opts.Replace)
+
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(vars))
+
+	for k := range vars {
+		keys = append(keys, k)
+	}
+
+	if cleared {
+		if err = e.audit("clear", realm); err != nil {
+			return err
+		}
+	}
+
+	if err := e.audit("add", realm, keys...); err != nil || !expiring {
+		return err
+	}
+
+	return e.audit("expire", realm, keys...)
+}
+
+// setKeys stores the records in the realm, in place of its old
+// contents (which go to the trash) if replace is set and it has
+// any, in which case it returns true.
+func (e *Envy) setKeys(realm string, m internal.Stored, replace bool) (bool, error) {
+	if !replace {
+		return false, e.db.SetKeys(realm, m)
+	}
+
+	old, err := e.db.GetAllKeys(realm)
+
+	if errors.Is(err, internal.ErrNotFound) || (err == nil && len(old) == 0) {
+		return false, e.db.SetKeys(realm, m)
+	} else if err != nil {
+		return false, err
+	}
+
+	id, sd, err := e.trashItem(realm, "", old)
+
+	if err != nil {
+		return false, err
+	}
+
+	if err = e.db.Clear(realm, id, sd, m); err != nil {
+		return false, err
+	}
+
+	return true, e.expireTrash()
 }
 
 // fetchRaw does the real work of getting data from the DB.
@@ -107,10 +353,16 @@ func (e *Envy) fetchRaw(realm string) (internal.Loaded, error) {
 		return nil, fmt.Errorf("fetching %s: %w", realm, err)
 	}
 
+	s, err := e.realmSealer(realm, false)
+
+	if err != nil {
+		return nil, err
+	}
+
 	result := make(internal.Loaded, len(m))
 
 	for k, sd := range m {
-		ud, err := e.sealer.Unseal(sd)
+		ud, err := s.UnsealFor(realm, k, sd)
 
 		if err != nil {
 			return nil, fmt.Errorf("unsealing %s/%s: %w", realm, k, err)
@@ -123,18 +375,81 @@ func (e *Envy) fetchRaw(realm string) (internal.Loaded, error) {
 }
 
 // Fetch returns a map of {variable, value} pairs from the
-// secure store for the given realm, if present.
+// secure store for the given realm, if present. (Binary
+// values are base64.)
 func (e *Envy) Fetch(realm string) (map[string]string, error) {
+	return e.FetchContext(context.Background(), realm)
+}
+
+// FetchContext is like Fetch, but stops if ctx is done.
+func (e *Envy) FetchContext(ctx context.Context, realm string) (map[string]string, error) {
+	m, err := e.FetchWithContext(ctx, realm, FetchOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(m))
+
+	for k, v := range m {
+		result[k] = v.Data
+	}
+
+	return result, nil
+}
+
+// FetchValues is like Fetch, with each value's type.
+func (e *Envy) FetchValues(realm string) (map[string]Value, error) {
+	return e.FetchWith(realm, FetchOptions{})
+}
+
+// FetchWith is like FetchValues, with more options.
+func (e *Envy) FetchWith(realm string, opts FetchOptions) (map[string]Value, error) {
+	return e.FetchWithContext(context.Background(), realm, opts)
+}
+
+// FetchWithContext is like FetchWith, but stops if ctx is done
+// (checked before reading each realm).
+func (e *Envy) FetchWithContext(ctx context.Context, realm string, opts FetchOptions) (map[string]Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := e.checkReveal(realm); err != nil {
+		return nil, err
+	}
+
 	m, err := e.fetchRaw(realm)
 
 	if err != nil {
 		return nil, fmt.Errorf("fetching %s: %w", realm, err)
 	}
 
-	result := make(map[string]string, len(m))
+	r := e.newResolver(ctx, opts)
+	r.loaded[realm] = m
+
+	result := make(map[string]Value, len(m))
 
 	for k, ud := range m {
-		result[k] = ud.Data
+		v := Value{Data: ud.Data, Type: ud.Meta.Type}
+
+		if !opts.Unresolved && v.Type == TypeTemplate {
+			if v.Data, err = r.resolve(realm, k); err != nil {
+				return nil, fmt.Errorf("resolving %s/%s: %w", realm, k, err)
+			}
+
+			v.Type = ""
+		}
+
+		result[k] = v
+	}
+
+	if err = e.audit("fetch", realm); err != nil {
+		return nil, err
+	}
+
+	if err = r.audit(realm); err != nil {
+		return nil, err
 	}
 
 	return result, nil
@@ -143,14 +458,15 @@ func (e *Envy) Fetch(realm string) (map[string]string, error) {
 // FetchAsJSON returns the variables for a given realm as a
 // JSON object. This is handy for other tools using Envy as a
 // library, e.g., to store secure login credentials / tokens.
+// Values are written as JSON of their type.
 func (e *Envy) FetchAsJSON(realm string) (json.RawMessage, error) {
-	m, err := e.Fetch(realm)
+	m, err := e.FetchValues(realm)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return json.Marshal(m)
+	return ValuesAsJSON(m)
 }
 
 // FetchAsVarList returns the variables in a realm as a list of
@@ -176,43 +492,269 @@ func (e *Envy) FetchAsVarList(realm string) ([]string, error) {
 // secure store, possibly creating it and/or overwriting
 // and existing key.
 func (e *Envy) Set(realm, key, data string) error {
-	ud := internal.Unsealed{Data: data}
-	sd, err := e.sealer.Seal(ud)
+	return e.SetValue(realm, key, Value{Data: data})
+}
+
+// SetValue is like Set for a value of any type.
+func (e *Envy) SetValue(realm, key string, v Value) error {
+	if err := v.check(); err != nil {
+		return fmt.Errorf("%s/%s: %w", realm, key, err)
+	}
+
+	s, err := e.realmSealer(realm, true)
+
+	if err != nil {
+		return err
+	}
+
+	v = v.normal()
+	ud := internal.Unsealed{Data: v.Data}
+	ud.Meta.MaxAge = e.maxAge(realm, key)
+	ud.Meta.Type = v.Type
+
+	sd, err := s.SealFor(realm, key, ud)
 
 	if err != nil {
 		return fmt.Errorf("sealing %s/%s: %w", realm, key, err)
 	}
 
-	return e.db.SetKey(realm, key, sd)
+	if err = e.db.SetKey(realm, key, sd); err != nil {
+		return err
+	}
+
+	return e.audit("set", realm, key)
 }
 
 // Get returns a single key's value from the realm, if it
-// is present.
+// is present. (A binary value is base64.)
 func (e *Envy) Get(realm, key string) (string, error) {
+	return e.GetContext(context.Background(), realm, key)
+}
+
+// GetContext is like Get, but stops if ctx is done.
+func (e *Envy) GetContext(ctx context.Context, realm, key string) (string, error) {
+	v, err := e.GetWithContext(ctx, realm, key, FetchOptions{})
+	return v.Data, err
+}
+
+// GetValue is like Get, with the value's type.
+func (e *Envy) GetValue(realm, key string) (Value, error) {
+	return e.GetWith(realm, key, FetchOptions{})
+}
+
+// GetWith is like GetValue, with more options.
+func (e *Envy) GetWith(realm, key string, opts FetchOptions) (Value, error) {
+	return e.GetWithContext(context.Background(), realm, key, opts)
+}
+
+// GetWithContext is like GetWith, but stops if ctx is done
+// (checked before reading each realm).
+func (e *Envy) GetWithContext(ctx context.Context, realm, key string, opts FetchOptions) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return Value{}, err
+	}
+
+	if err := e.checkReveal(realm); err != nil {
+		return Value{}, err
+	}
+
+	sd, err := e.db.GetKey(realm, key)
+
+	if err != nil {
+		return Value{}, fmt.Errorf("fetching %s/%s: %w", realm, key, err)
+	}
+
+	s, err := e.realmSealer(realm, false)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	ud, err := s.UnsealFor(realm, key, sd)
+
+	if err != nil {
+		return Value{}, fmt.Errorf("unsealing %s/%s: %w", realm, key, err)
+	}
+
+	if err = e.audit("get", realm, key); err != nil {
+		return Value{}, err
+	}
+
+	v := Value{Data: ud.Data, Type: ud.Meta.Type}
+
+	if opts.Unresolved || v.Type != TypeTemplate {
+		return v, nil
+	}
+
+	r := e.newResolver(ctx, opts)
+
+	if v.Data, err = r.resolve(realm, key); err != nil {
+		return Value{}, fmt.Errorf("resolving %s/%s: %w", realm, key, err)
+	}
+
+	v.Type = ""
+	return v, r.audit("")
+}
+
+// maxAge returns the rotation period of an existing key, which
+// should carry over when its value is replaced. (A fixed expiry
+// applies only to the value it was set for, so it doesn't.)
+func (e *Envy) maxAge(realm, key string) int64 {
 	sd, err := e.db.GetKey(realm, key)
 
 	if err != nil {
-		return "", fmt.Errorf("fetching %s/%s: %w", realm, key, err)
+		return 0
 	}
 
-	ud, err := e.sealer.Unseal(sd)
+	md, err := sd.Metadata()
 
 	if err != nil {
-		return "", fmt.Errorf("unsealing %s/%s: %w", realm, key, err)
+		return 0
+	}
+
+	return md.MaxAge
+}
+
+// SetExpiry sets a key to expire at a fixed time, or after a
+// maximum age since it was last changed; the latter persists
+// when the value is replaced. Zero values clear the expiry.
+func (e *Envy) SetExpiry(realm, key string, expires time.Time, maxAge time.Duration) error {
+	sd, err := e.db.GetKey(realm, key)
+
+	if err != nil {
+		return fmt.Errorf("fetching %s/%s: %w", realm, key, err)
+	}
+
+	s, err := e.realmSealer(realm, false)
+
+	if err != nil {
+		return err
+	}
+
+	ud, err := s.UnsealFor(realm, key, sd)
+
+	if err != nil {
+		return fmt.Errorf("unsealing %s/%s: %w", realm, key, err)
+	}
+
+	ud.Meta.Expires = 0
+	ud.Meta.MaxAge = int64(maxAge / time.Second)
+
+	if !expires.IsZero() {
+		ud.Meta.Expires = expires.Unix()
+	}
+
+	if sd, err = s.SealFor(realm, key, ud); err != nil {
+		return fmt.Errorf("sealing %s/%s: %w", realm, key, err)
+	}
+
+	if err = e.db.SetKey(realm, key, sd); err != nil {
+		return err
+	}
+
+	return e.audit("expire", realm, key)
+}
+
+// Expiry describes a key that has expired or will soon.
+type Expiry struct {
+	Realm   string
+	Key     string
+	Expires time.Time
+}
+
+// Expired reports whether the key has already expired.
+func (x Expiry) Expired() bool {
+	return !time.Now().Before(x.Expires)
+}
+
+// Expiring returns the keys in the given realms (or all realms,
+// if none are given) that have expired or will expire within
+// the given duration, soonest first. It only reads metadata,
+// so nothing is decrypted.
+func (e *Envy) Expiring(within time.Duration, realms ...string) ([]Expiry, error) {
+	if len(realms) == 0 {
+		var err error
+
+		if realms, err = e.Realms(); err != nil {
+			return nil, err
+		}
 	}
 
-	return ud.Data, nil
+	limit := time.Now().Add(within)
+	result := make([]Expiry, 0)
+
+	for _, r := range realms {
+		m, err := e.db.GetAllKeys(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s: %w", r, err)
+		}
+
+		for k, sd := range m {
+			md, err := sd.Metadata()
+
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s/%s: %w", r, k, err)
+			}
+
+			if t := md.Expiry(); !t.IsZero() && t.Before(limit) {
+				result = append(result, Expiry{Realm: r, Key: k, Expires: t})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Expires.Before(result[j].Expires)
+	})
+
+	return result, nil
 }
 
-// Drop removes a single key from the realm's secure store.
+// Drop moves a single key from the realm to the trash.
 func (e *Envy) Drop(realm, key string) error {
-	return e.db.DropKey(realm, key)
+	sd, err := e.db.GetKey(realm, key)
+
+	if err != nil {
+		return fmt.Errorf("fetching %s/%s: %w", realm, key, err)
+	}
+
+	if err = e.trash(realm, key, internal.Stored{key: sd}, false); err != nil {
+		return err
+	}
+
+	return e.audit("drop", realm, key)
 }
 
-// Purge removes an entire realm from the secure store.
-// Use with caution.
+// Purge moves an entire realm from the secure store to
+// the trash. Use with caution.
 func (e *Envy) Purge(realm string) error {
-	return e.db.Purge(realm)
+	m, err := e.db.GetAllKeys(realm)
+
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", realm, err)
+	}
+
+	if err = e.trash(realm, "", m, false); err != nil {
+		return err
+	}
+
+	return e.audit("purge", realm)
+}
+
+// Clear moves all the realm's variables to the trash, like Purge,
+// but keeps the realm itself, with its data key and any policy.
+func (e *Envy) Clear(realm string) error {
+	m, err := e.db.GetAllKeys(realm)
+
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", realm, err)
+	}
+
+	if err = e.trash(realm, "", m, true); err != nil {
+		return err
+	}
+
+	return e.audit("clear", realm)
 }
 
 // Realms returns a list of the realms in the secure store.
@@ -230,6 +772,24 @@ func (e *Envy) Realms() ([]string, error) {
 // List writes to its destination a single realm's variables and
 // their metadata, and optionally their values (use with caution).
 func (e *Envy) List(w io.Writer, realm, key string, decrypt bool) error {
+	return e.ListWith(w, realm, key, ListOptions{Decrypt: decrypt})
+}
+
+// ListOptions control what's shown for each variable
+// beyond its metadata.
+type ListOptions struct {
+	Decrypt bool // show the value (use with caution)
+	Inspect bool // show the expiry, subject & issuer of JWTs and certificates
+}
+
+// ListWith is like List, with more options.
+func (e *Envy) ListWith(w io.Writer, realm, key string, opts ListOptions) error {
+	if opts.Decrypt || opts.Inspect {
+		if err := e.checkReveal(realm); err != nil {
+			return err
+		}
+	}
+
 	m, err := e.fetchRaw(realm)
 
 	if err != nil {
@@ -261,31 +821,91 @@ func (e *Envy) List(w io.Writer, realm, key string, decrypt bool) error {
 
 	sort.Strings(keys)
 
+	if opts.Decrypt {
+		if err = e.audit("list", realm, keys...); err != nil {
+			return err
+		}
+	}
+
 	for _, k := range keys {
 		ud := m[k]
+		line := fmt.Sprintf("%-*s   %s", maxWidth, k, ud.Meta.ToString(maxSize))
+
+		if opts.Inspect {
+			if i := internal.Inspect(ud.Data); i != nil {
+				line += "   [" + i.Summary() + "]"
+			}
+		}
 
-		if decrypt {
-			fmt.Fprintf(w, "%-*s   %s   %s\n", maxWidth, k, ud.Meta.ToString(maxSize), ud.Data)
-		} else {
-			fmt.Fprintf(w, "%-*s   %s\n", maxWidth, k, ud.Meta.ToString(maxSize))
+		if opts.Decrypt {
+			line += "   " + ud.Data
 		}
+
+		fmt.Fprintln(w, line)
 	}
 
 	return nil
 }
 
-// Read takes JSON input and writes the contents into the
-// realm (assumed to be an object with key-value pairs).
-func (e *Envy) Read(r io.Reader, realm string) error {
-	m := make(map[string]string)
+// audit records an operation on the realm (or on some of its
+// keys) in the audit log, which is signed with a key derived
+// from the secret key.
+func (e *Envy) audit(op, realm string, keys ...string) error {
+	user := e.CurrentUser()
+	entries := make([]internal.AuditEntry, 0, len(keys)+1)
+
+	if len(keys) == 0 {
+		entries = append(entries, internal.NewAuditEntry(op, realm, "", user))
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		entries = append(entries, internal.NewAuditEntry(op, realm, k, user))
+	}
 
-	err := json.NewDecoder(r).Decode(&m)
+	key, err := e.sealer.SubKey("audit")
+
+	if err == nil {
+		err = e.db.AppendAudit(key, entries...)
+	}
+
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	return nil
+}
+
+// Audit returns the entries in the audit log, oldest first.
+func (e *Envy) Audit() ([]internal.AuditEntry, error) {
+	entries, _, err := e.db.ListAudit()
+	return entries, err
+}
+
+// VerifyAudit checks that no entry in the audit log has been
+// altered, removed, or reordered.
+func (e *Envy) VerifyAudit() error {
+	entries, head, err := e.db.ListAudit()
+
+	if err != nil {
+		return err
+	}
+
+	key, err := e.sealer.SubKey("audit")
 
 	if err != nil {
 		return err
 	}
 
-	return e.Add(realm, m)
+	return internal.VerifyAudit(entries, head, key)
+}
+
+// Read takes JSON input and writes the contents into the
+// realm (assumed to be an object with key-value pairs); values
+// that aren't strings keep their type (see ValueFromJSON).
+func (e *Envy) Read(r io.Reader, realm string) error {
+	return e.ReadWith(r, realm, ReadOptions{})
 }
 
 // Close closes the DB. Clients should defer this once
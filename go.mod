@@ -5,5 +5,7 @@ go 1.15
 require (
 	github.com/boltdb/bolt v1.3.1
 	github.com/zalando/go-keyring v0.1.0
+	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
 	golang.org/x/sys v0.0.0-20201009025420-dfb3f7c4e634 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,412 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	agentSocketEnv = "ENVY_AGENT_SOCK"
+	agentSocket    = "agent.sock"
+)
+
+var (
+	ErrNoAgent     = errors.New("no agent running")
+	ErrAgentLocked = errors.New("agent is locked")
+	ErrBadAgentOp  = errors.New("invalid agent operation")
+	ErrNotSocket   = errors.New("exists and isn't a socket")
+	ErrSocketInUse = errors.New("socket is in use")
+)
+
+// AgentSocketPath returns the path of the agent's socket, which
+// is $ENVY_AGENT_SOCK if set, otherwise in the envy config dir.
+func AgentSocketPath() (string, error) {
+	if p := os.Getenv(agentSocketEnv); p != "" {
+		return p, nil
+	}
+
+	d, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(d, "envy", agentSocket), nil
+}
+
+type agentRequest struct {
+	Op   string `json:"op"`
+	Data string `json:"data,omitempty"` // base64
+	AAD  string `json:"aad,omitempty"`  // base64
+}
+
+type agentResponse struct {
+	Data  string `json:"data,omitempty"` // base64
+	Error string `json:"error,omitempty"`
+}
+
+// Agent holds the secret key in (locked) memory on behalf of
+// short-lived envy commands, much like ssh-agent. It never gives
+// out the key, only uses it to seal and unseal data (and derive
+// subkeys) for them. The key is wiped when the agent has been idle
+// for its timeout, and fetched again from the ring on the next
+// request; when the agent is told to lock, the key is wiped and
+// requests are refused until it's told to unlock.
+type Agent struct {
+	ring    Ring
+	noncer  Noncer
+	timeout time.Duration
+
+	mu     sync.Mutex
+	key    []byte
+	timer  *time.Timer
+	locked bool
+}
+
+func NewAgent(r Ring, timeout time.Duration) *Agent {
+	return &Agent{ring: r, noncer: &realNonce{}, timeout: timeout}
+}
+
+// Listen creates the agent's socket (see ListenUnix).
+func (a *Agent) Listen(fpath string) (net.Listener, error) {
+	if err := ensureDir(path.Dir(fpath)); err != nil {
+		return nil, err
+	}
+
+	return ListenUnix(fpath)
+}
+
+// ListenUnix creates a Unix socket with 0600 permissions (set by
+// the umask, so it's never open to others, even briefly). A stale
+// socket is replaced, but not one that something answers on, nor
+// a file that isn't a socket.
+func ListenUnix(fpath string) (net.Listener, error) {
+	if fi, err := os.Lstat(fpath); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s: %w", fpath, ErrNotSocket)
+		}
+
+		if c, err := net.Dial("unix", fpath); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s: %w", fpath, ErrSocketInUse)
+		}
+
+		if err = os.Remove(fpath); err != nil {
+			return nil, err
+		}
+	}
+
+	mask := syscall.Umask(0177)
+	l, err := net.Listen("unix", fpath)
+
+	syscall.Umask(mask)
+	return l, err
+}
+
+// Serve answers requests until the listener is closed, and
+// wipes the key before returning.
+func (a *Agent) Serve(l net.Listener) error {
+	defer a.idle()
+
+	for {
+		c, err := l.Accept()
+
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return err
+		}
+
+		go a.handle(c)
+	}
+}
+
+// Locked reports whether the agent isn't holding a key.
+func (a *Agent) Locked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.key == nil
+}
+
+// Lock wipes the key from memory, and refuses requests
+// until Unlock.
+func (a *Agent) Lock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.wipe()
+	a.locked = true
+}
+
+// Unlock fetches the key from the ring again after Lock.
+func (a *Agent) Unlock() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.locked = false
+	_, err := a.unlocked()
+
+	return err
+}
+
+// idle wipes the key from memory, to be fetched again when
+// it's next needed.
+func (a *Agent) idle() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.wipe()
+}
+
+func (a *Agent) wipe() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+
+	if a.key == nil {
+		return
+	}
+
+	for i := range a.key {
+		a.key[i] = 0
+	}
+
+	_ = syscall.Munlock(a.key)
+	a.key = nil
+}
+
+// unlocked returns the key, fetching it from the ring if
+// need be (unless the agent is locked), and restarts the idle
+// timer. It must be called with the mutex held.
+func (a *Agent) unlocked() ([]byte, error) {
+	if a.locked {
+		return nil, ErrAgentLocked
+	}
+
+	if a.key == nil {
+		k, err := a.ring.GetSecret()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the copy is what gets locked into memory; not
+		// being able to lock it (e.g., rlimits) isn't fatal
+
+		a.key = make([]byte, len(k))
+		_ = syscall.Mlock(a.key)
+		copy(a.key, k)
+
+		for i := range k {
+			k[i] = 0
+		}
+	}
+
+	if a.timeout > 0 {
+		if a.timer != nil {
+			a.timer.Stop()
+		}
+
+		a.timer = time.AfterFunc(a.timeout, a.idle)
+	}
+
+	return a.key, nil
+}
+
+func (a *Agent) handle(c net.Conn) {
+	defer c.Close()
+
+	dec := json.NewDecoder(c)
+	enc := json.NewEncoder(c)
+
+	for {
+		var req agentRequest
+
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		var resp agentResponse
+
+		if data, err := a.answer(req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Data = data
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (a *Agent) answer(req agentRequest) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch req.Op {
+	case "lock":
+		a.wipe()
+		a.locked = true
+		return "", nil
+
+	case "unlock":
+		a.locked = false
+		_, err := a.unlocked()
+		return "", err
+
+	case "status":
+		if a.key == nil {
+			return "locked", nil
+		}
+
+		return "unlocked", nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(req.Data)
+
+	if err != nil {
+		return "", err
+	}
+
+	aad, err := base64.StdEncoding.DecodeString(req.AAD)
+
+	if err != nil {
+		return "", err
+	}
+
+	key, err := a.unlocked()
+
+	if err != nil {
+		return "", err
+	}
+
+	var result []byte
+
+	switch req.Op {
+	case "derive":
+		result = deriveKey(key, string(data))
+
+	case "seal":
+		var nonce []byte
+
+		if nonce, err = a.noncer.GetNonce(); err == nil {
+			result, err = gcmSeal(key, nonce, data, aad)
+		}
+
+	case "unseal":
+		result, err = gcmOpen(key, data, aad)
+
+	default:
+		err = fmt.Errorf("%s: %w", req.Op, ErrBadAgentOp)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(result), nil
+}
+
+// AgentClient talks to a running agent over its socket.
+type AgentClient struct {
+	path string
+}
+
+func NewAgentClient(fpath string) *AgentClient {
+	return &AgentClient{fpath}
+}
+
+func (c *AgentClient) call(op string, data, aad []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", c.path, time.Second)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.path, ErrNoAgent)
+	}
+
+	defer conn.Close()
+
+	req := agentRequest{
+		Op:   op,
+		Data: base64.StdEncoding.EncodeToString(data),
+		AAD:  base64.StdEncoding.EncodeToString(aad),
+	}
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+
+	var resp agentResponse
+
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	switch resp.Error {
+	case "":
+	case ErrAgentLocked.Error():
+		return nil, ErrAgentLocked
+	default:
+		return nil, fmt.Errorf("agent: %s", resp.Error)
+	}
+
+	if op == "status" {
+		return []byte(resp.Data), nil
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Data)
+}
+
+// Running reports whether an agent answers on the socket.
+func (c *AgentClient) Running() bool {
+	_, err := c.call("status", nil, nil)
+	return err == nil
+}
+
+// Status returns "locked" or "unlocked".
+func (c *AgentClient) Status() (string, error) {
+	s, err := c.call("status", nil, nil)
+	return string(s), err
+}
+
+// Lock tells the agent to wipe its key and refuse
+// requests until Unlock.
+func (c *AgentClient) Lock() error {
+	_, err := c.call("lock", nil, nil)
+	return err
+}
+
+// Unlock tells the agent to fetch its key again.
+func (c *AgentClient) Unlock() error {
+	_, err := c.call("unlock", nil, nil)
+	return err
+}
+
+// Derive has the agent derive a key for some purpose from
+// its key (see Sealer.SubKey).
+func (c *AgentClient) Derive(purpose string) ([]byte, error) {
+	return c.call("derive", []byte(purpose), nil)
+}
+
+// Seal has the agent encrypt data, returning the nonce
+// followed by the ciphertext.
+func (c *AgentClient) Seal(pt, aad []byte) ([]byte, error) {
+	return c.call("seal", pt, aad)
+}
+
+// Unseal has the agent decrypt data from Seal.
+func (c *AgentClient) Unseal(ct, aad []byte) ([]byte, error) {
+	return c.call("unseal", ct, aad)
+}
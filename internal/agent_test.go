@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestAgent(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	sock := path.Join(dname, "agent.sock")
+	a := NewAgent(testRing, 100*time.Millisecond)
+	l, err := a.Listen(sock)
+
+	if err != nil {
+		t.Fatal("listen", err)
+	}
+
+	defer l.Close()
+
+	go a.Serve(l) //nolint:errcheck
+
+	if fi, err := os.Stat(sock); err != nil {
+		t.Fatal("stat", err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("invalid mode: %v", fi.Mode())
+	}
+
+	if _, err := a.Listen(sock); err == nil {
+		t.Errorf("second agent allowed")
+	}
+
+	r := NewAgentClient(sock)
+
+	if s, err := r.Status(); err != nil || s != "locked" {
+		t.Errorf("initial status: %s %v", s, err)
+	}
+
+	// the key itself is never given out
+
+	if _, err := r.call("get", nil, nil); err == nil {
+		t.Errorf("agent gave out its key")
+	}
+
+	k, _ := testRing.GetSecret()
+
+	if sk, err := r.Derive("audit"); err != nil || !bytes.Equal(sk, deriveKey(k, "audit")) {
+		t.Errorf("invalid subkey: %x %v", sk, err)
+	}
+
+	ct, err := r.Seal([]byte("matt"), []byte("tag"))
+
+	if err != nil {
+		t.Fatal("seal", err)
+	}
+
+	if pt, err := r.Unseal(ct, []byte("tag")); err != nil {
+		t.Error("unseal", err)
+	} else if string(pt) != "matt" {
+		t.Errorf("invalid unseal: %q", pt)
+	}
+
+	if _, err := r.Unseal(ct, []byte("gat")); err == nil {
+		t.Errorf("unseal with bad aad")
+	}
+
+	// a sealer using the agent works with one using the key
+
+	as := &Sealer{Ring: testRing, agent: r, noncer: testNonce}
+	sd, err := as.SealFor("top", "a", Unsealed{Data: "matt"})
+
+	if err != nil {
+		t.Fatal("agent seal", err)
+	}
+
+	if ud, err := NewTestSealer().UnsealFor("top", "a", sd); err != nil || ud.Data != "matt" {
+		t.Errorf("invalid unseal of agent record: %#v %v", ud, err)
+	}
+
+	// once locked, it stays locked until told to unlock
+
+	if err := r.Lock(); err != nil {
+		t.Error("lock", err)
+	}
+
+	if !a.Locked() {
+		t.Errorf("not locked")
+	}
+
+	if _, err := r.Seal([]byte("matt"), nil); !errors.Is(err, ErrAgentLocked) {
+		t.Errorf("sealed after lock: %v", err)
+	}
+
+	if _, err := as.SubKey("audit"); !errors.Is(err, ErrAgentLocked) {
+		t.Errorf("derived after lock: %v", err)
+	}
+
+	if err := r.Unlock(); err != nil {
+		t.Fatal("unlock", err)
+	}
+
+	if s, err := r.Status(); err != nil || s != "unlocked" {
+		t.Errorf("status after unlock: %s %v", s, err)
+	}
+
+	// but when idle, it fetches the key again as needed
+
+	time.Sleep(250 * time.Millisecond)
+
+	if !a.Locked() {
+		t.Errorf("not locked after timeout")
+	}
+
+	if _, err := r.Seal([]byte("matt"), nil); err != nil {
+		t.Errorf("seal after timeout: %v", err)
+	}
+}
+
+func TestAgentNotRunning(t *testing.T) {
+	r := NewAgentClient("/nonexistent/agent.sock")
+
+	if r.Running() {
+		t.Errorf("agent running?")
+	}
+
+	if _, err := r.Derive("audit"); !errors.Is(err, ErrNoAgent) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
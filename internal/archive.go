@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	backupFormat  = "envy-backup"
+	backupVersion = 1
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrBadArchive    = errors.New("not an envy archive")
+	ErrBadPassphrase = errors.New("wrong passphrase or corrupted archive")
+)
+
+// Archive holds realms with their (unsealed) values and
+// metadata, and the policies of those that are protected;
+// it's only ever written out encrypted.
+type Archive struct {
+	Created  int64                          `json:"created"`
+	Realms   map[string]map[string]Unsealed `json:"realms"`
+	Policies map[string]*Protection         `json:"policies,omitempty"`
+}
+
+func NewArchive() *Archive {
+	return &Archive{
+		Realms:   make(map[string]map[string]Unsealed),
+		Policies: make(map[string]*Protection),
+	}
+}
+
+type kdfParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+type backupFile struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	KDF     kdfParams `json:"kdf"`
+	Data    []byte    `json:"data"` // nonce + ciphertext
+}
+
+// aad binds the file's header to its contents.
+func (f backupFile) aad() []byte {
+	return []byte(fmt.Sprintf("%s/%d/%s/%x/%d/%d/%d", f.Format, f.Version, f.KDF.Name, f.KDF.Salt, f.KDF.N, f.KDF.R, f.KDF.P))
+}
+
+func (k kdfParams) derive(passphrase []byte) ([]byte, error) {
+	if k.Name != "scrypt" {
+		return nil, fmt.Errorf("kdf %s: %w", k.Name, ErrBadArchive)
+	}
+
+	// don't let a bad file make us use all the memory
+
+	if k.N > 1<<20 || k.R > 32 || k.P > 16 {
+		return nil, fmt.Errorf("kdf parameters: %w", ErrBadArchive)
+	}
+
+	return scrypt.Key(passphrase, k.Salt, k.N, k.R, k.P, 32)
+}
+
+// WriteBackup encrypts the archive under a key derived from
+// the passphrase, which is independent of the keychain.
+func (a *Archive) WriteBackup(w io.Writer, passphrase []byte) error {
+	f := backupFile{
+		Format:  backupFormat,
+		Version: backupVersion,
+		KDF:     kdfParams{Name: "scrypt", Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP},
+	}
+
+	if _, err := io.ReadFull(rand.Reader, f.KDF.Salt); err != nil {
+		return err
+	}
+
+	key, err := f.KDF.derive(passphrase)
+
+	if err != nil {
+		return err
+	}
+
+	pt, err := json.Marshal(a)
+
+	if err != nil {
+		return err
+	}
+
+	nonce, err := realNonce{}.GetNonce()
+
+	if err != nil {
+		return err
+	}
+
+	if f.Data, err = gcmSeal(key, nonce, pt, f.aad()); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(f)
+}
+
+// ReadBackup decrypts an archive written by WriteBackup.
+func ReadBackup(r io.Reader, passphrase []byte) (*Archive, error) {
+	var f backupFile
+
+	if err := json.NewDecoder(r).Decode(&f); err != nil || f.Format != backupFormat {
+		return nil, ErrBadArchive
+	}
+
+	if f.Version != backupVersion {
+		return nil, fmt.Errorf("version %d: %w", f.Version, ErrBadArchive)
+	}
+
+	key, err := f.KDF.derive(passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pt, err := gcmOpen(key, f.Data, f.aad())
+
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	a := NewArchive()
+
+	if err = json.Unmarshal(pt, a); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrBadArchive)
+	}
+
+	return a, nil
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBackupArchive(t *testing.T) {
+	a := NewArchive()
+	a.Created = 1602480485
+	a.Realms["top"] = map[string]Unsealed{
+		"a": {Data: "XX", Meta: metadata{Size: 2, Hash: "abc", Modified: 1602480485, MaxAge: 3600}},
+	}
+
+	a.Policies["top"] = &Protection{KDF: kdfParams{Name: "scrypt", Salt: []byte("salt"), N: 2, R: 1, P: 1}, Verifier: []byte("v")}
+
+	b := new(bytes.Buffer)
+
+	if err := a.WriteBackup(b, []byte("sekrit")); err != nil {
+		t.Fatal("write", err)
+	}
+
+	if bytes.Contains(b.Bytes(), []byte(`"XX"`)) {
+		t.Errorf("plaintext in backup: %s", b)
+	}
+
+	raw := b.Bytes()
+
+	if _, err := ReadBackup(bytes.NewReader(raw), []byte("secret")); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+
+	a2, err := ReadBackup(bytes.NewReader(raw), []byte("sekrit"))
+
+	if err != nil {
+		t.Fatal("read", err)
+	} else if !reflect.DeepEqual(a, a2) {
+		t.Errorf("invalid archive: %#v", a2)
+	}
+
+	if _, err := ReadBackup(bytes.NewBufferString(`{"format":"other"}`), []byte("sekrit")); !errors.Is(err, ErrBadArchive) {
+		t.Errorf("bad archive: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrAuditBroken = errors.New("audit log has been tampered with")
+
+// AuditEntry records one access to the store. Each entry has
+// a MAC over its contents and the previous entry's MAC, so that
+// entries can't be edited, removed, or reordered unnoticed.
+type AuditEntry struct {
+	Seq     uint64 `json:"seq"`
+	Time    int64  `json:"time"` // Unix time in nanoseconds
+	Op      string `json:"op"`
+	Realm   string `json:"realm"`
+	Key     string `json:"key,omitempty"`
+	User    string `json:"user"`
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Parent  string `json:"parent"` // the parent's command line
+	Prev    string `json:"prev"`   // the previous entry's MAC
+	MAC     string `json:"mac"`
+	Hidden  bool   `json:"hidden,omitempty"` // the realm & key are encrypted
+	Headed  bool   `json:"headed,omitempty"` // written along with a head
+}
+
+// AuditHead records the last entry in the audit log, with its
+// own MAC, so that entries can't be removed from the end (with
+// the sequence reset) unnoticed. A log from before heads were
+// kept has a head with only the DB's sequence number.
+type AuditHead struct {
+	Seq uint64 `json:"seq"`
+	MAC string `json:"mac"` // the last entry's MAC
+	Sig string `json:"sig"`
+}
+
+// Sign computes the head's MAC (which is not itself covered).
+func (h AuditHead) Sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+
+	fmt.Fprintf(mac, "head:%d:%s", h.Seq, h.MAC)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Valid reports whether the head was signed with the key.
+func (h AuditHead) Valid(key []byte) bool {
+	return h.Sig != "" && hmac.Equal([]byte(h.Sig), []byte(h.Sign(key)))
+}
+
+// NewAuditEntry fills in who's doing the operation; the DB
+// fills in the sequence and the chaining.
+func NewAuditEntry(op, realm, key, user string) AuditEntry {
+	return AuditEntry{
+		Time:    time.Now().UnixNano(),
+		Op:      op,
+		Realm:   realm,
+		Key:     key,
+		User:    user,
+		PID:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+		Parent:  commandLine(os.Getppid()),
+	}
+}
+
+func (a AuditEntry) String() string {
+	target := a.Realm
+
+	if a.Key != "" {
+		target += "/" + a.Key
+	}
+
+	return fmt.Sprintf("%6d  %s  %-6s %s  %s  pid=%d  %q  parent=%q", a.Seq,
+		time.Unix(0, a.Time).Format(time.RFC3339), a.Op, target, a.User, a.PID, a.Command, a.Parent)
+}
+
+// Sign computes the entry's MAC (which is not itself covered).
+func (a AuditEntry) Sign(key []byte) string {
+	a.MAC = ""
+
+	b, _ := json.Marshal(a)
+	mac := hmac.New(sha256.New, key)
+
+	_, _ = mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAudit checks the chain of entries, which must be in
+// order, and that the last one is the head, so that we know if
+// any entries were removed from the end.
+func VerifyAudit(entries []AuditEntry, head AuditHead, key []byte) error {
+	var prev string
+	var seq uint64
+
+	if head.Sig != "" && !head.Valid(key) {
+		return fmt.Errorf("head altered: %w", ErrAuditBroken)
+	}
+
+	for _, a := range entries {
+		if a.Headed && head.Sig == "" {
+			return fmt.Errorf("entry %d has no head: %w", a.Seq, ErrAuditBroken)
+		}
+
+		if a.Seq != seq+1 {
+			return fmt.Errorf("entry %d missing: %w", seq+1, ErrAuditBroken)
+		}
+
+		if a.Prev != prev {
+			return fmt.Errorf("entry %d not chained: %w", a.Seq, ErrAuditBroken)
+		}
+
+		if !hmac.Equal([]byte(a.MAC), []byte(a.Sign(key))) {
+			return fmt.Errorf("entry %d altered: %w", a.Seq, ErrAuditBroken)
+		}
+
+		prev = a.MAC
+		seq = a.Seq
+	}
+
+	if seq != head.Seq {
+		return fmt.Errorf("entries %d-%d missing: %w", seq+1, head.Seq, ErrAuditBroken)
+	}
+
+	if head.Sig != "" && prev != head.MAC {
+		return fmt.Errorf("entry %d isn't the head: %w", seq, ErrAuditBroken)
+	}
+
+	return nil
+}
+
+// commandLine returns a process's command line, which
+// is in /proc on Linux but needs ps on macOS.
+func commandLine(pid int) string {
+	if b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline"); err == nil {
+		return strings.TrimSpace(string(bytes.ReplaceAll(b, []byte{0}, []byte{' '})))
+	}
+
+	b, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
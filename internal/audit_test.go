@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestAuditLog(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "/envy.db"))
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer db.Close()
+
+	key, _ := NewTestSealer().SubKey("audit")
+
+	if err := db.AppendAudit(key, NewAuditEntry("add", "top", "a", "test-user"), NewAuditEntry("add", "top", "b", "test-user")); err != nil {
+		t.Fatal("append", err)
+	}
+
+	for _, op := range []string{"get", "drop", "purge"} {
+		if err := db.AppendAudit(key, NewAuditEntry(op, "top", "a", "test-user")); err != nil {
+			t.Fatal("append", op, err)
+		}
+	}
+
+	entries, head, err := db.ListAudit()
+
+	if err != nil {
+		t.Fatal("list", err)
+	}
+
+	t.Log(entries[0])
+
+	if len(entries) != 5 || head.Seq != 5 || entries[4].Op != "purge" || entries[2].PID != os.Getpid() {
+		t.Fatalf("invalid entries: %v", entries)
+	}
+
+	if err := VerifyAudit(entries, head, key); err != nil {
+		t.Error("verify", err)
+	}
+
+	if err := VerifyAudit(entries, head, []byte("wrong")); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify with wrong key: %v", err)
+	}
+
+	if err := VerifyAudit(entries[:4], head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify truncated: %v", err)
+	}
+
+	if err := VerifyAudit(append(entries[:1:1], entries[2:]...), head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify with removal: %v", err)
+	}
+
+	// tamper with the DB directly as an attacker might
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(auditBucket))
+
+		var a AuditEntry
+
+		if err := json.Unmarshal(bk.Get(seqKey(3)), &a); err != nil {
+			return err
+		}
+
+		a.Op = "list"
+
+		v, _ := json.Marshal(a)
+		return bk.Put(seqKey(3), v)
+	})
+
+	if err != nil {
+		t.Fatal("tamper", err)
+	}
+
+	entries, head, _ = db.ListAudit()
+
+	if err := VerifyAudit(entries, head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify after edit: %v", err)
+	} else {
+		t.Log(err)
+	}
+
+	if realms, err := db.ListRealms(); err != nil || len(realms) != 0 {
+		t.Errorf("audit log listed as realm: %v %v", realms, err)
+	}
+
+	if err := db.Purge(auditBucket); !errors.Is(err, ErrReserved) {
+		t.Errorf("purged audit log: %v", err)
+	}
+
+	// other names starting with a dot are fine
+
+	if err := db.SetKey(".old", "a", Sealed{Data: "a"}); err != nil {
+		t.Errorf("set in .old: %v", err)
+	}
+
+	if realms, err := db.ListRealms(); err != nil || len(realms) != 1 || realms[0] != ".old" {
+		t.Errorf("invalid realms: %v %v", realms, err)
+	}
+}
+
+func TestAuditTruncated(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "/envy.db"))
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer db.Close()
+
+	key, _ := NewTestSealer().SubKey("audit")
+
+	for _, op := range []string{"add", "get", "drop"} {
+		if err := db.AppendAudit(key, NewAuditEntry(op, "top", "a", "test-user")); err != nil {
+			t.Fatal("append", op, err)
+		}
+	}
+
+	// remove the last entry and reset the sequence to match
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(auditBucket))
+
+		if err := bk.Delete(seqKey(3)); err != nil {
+			return err
+		}
+
+		return bk.SetSequence(2)
+	})
+
+	if err != nil {
+		t.Fatal("tamper", err)
+	}
+
+	entries, head, _ := db.ListAudit()
+
+	if err := VerifyAudit(entries, head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify after truncation: %v", err)
+	}
+
+	// the gap stays after more entries are added
+
+	if err := db.AppendAudit(key, NewAuditEntry("get", "top", "a", "test-user")); err != nil {
+		t.Fatal("append", err)
+	}
+
+	entries, head, _ = db.ListAudit()
+
+	if err := VerifyAudit(entries, head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify after append: %v", err)
+	}
+
+	// nor can the head be removed
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(configBucket)).Delete([]byte(auditHeadKey))
+	})
+
+	if err != nil {
+		t.Fatal("tamper", err)
+	}
+
+	entries, head, _ = db.ListAudit()
+
+	if err := VerifyAudit(entries[:2], AuditHead{Seq: 2}, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify without head: %v", err)
+	}
+
+	if err := VerifyAudit(entries, head, key); !errors.Is(err, ErrAuditBroken) {
+		t.Errorf("verify without head: %v", err)
+	}
+}
+
+func TestAuditLegacy(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "/envy.db"))
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer db.Close()
+
+	key, _ := NewTestSealer().SubKey("audit")
+
+	// an entry from before heads were kept
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.CreateBucket([]byte(auditBucket))
+
+		if err != nil {
+			return err
+		}
+
+		a := NewAuditEntry("add", "top", "a", "test-user")
+		a.Seq, _ = bk.NextSequence()
+		a.MAC = a.Sign(key)
+
+		v, _ := json.Marshal(a)
+		return bk.Put(seqKey(a.Seq), v)
+	})
+
+	if err != nil {
+		t.Fatal("setup", err)
+	}
+
+	entries, head, _ := db.ListAudit()
+
+	if err := VerifyAudit(entries, head, key); err != nil {
+		t.Errorf("verify legacy: %v", err)
+	}
+
+	if err := db.AppendAudit(key, NewAuditEntry("get", "top", "a", "test-user")); err != nil {
+		t.Fatal("append", err)
+	}
+
+	entries, head, _ = db.ListAudit()
+
+	if err := VerifyAudit(entries, head, key); err != nil || len(entries) != 2 || head.Seq != 2 {
+		t.Errorf("verify after append: %v %v", entries, err)
+	}
+}
@@ -1,11 +1,15 @@
 package internal
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -20,27 +24,101 @@ type DB interface {
 	Purge(realm string) error
 	GetAllKeys(realm string) (Stored, error)
 	SetKeys(realm string, keys Stored) error
+	AppendAudit(key []byte, entries ...AuditEntry) error
+	ListAudit() ([]AuditEntry, AuditHead, error)
+	GetRealmKey(realm string) (Sealed, error)
+	SetRealmKey(realm string, key Sealed, records Stored) error
+	Rewrap(r Rewrap) error
+	GetIdentity() (Sealed, error)
+	SetIdentity(s Sealed) error
+	Check() error
+	Quarantine(realm, key string) error
+	Trash(realm, key, id string, item Sealed) error
+	Clear(realm, id string, item Sealed, records Stored) error
+	ListTrash() (map[string]Sealed, error)
+	SetTrash(id string, item Sealed) error
+	Untrash(id, realm string, key *Sealed, records Stored) error
+	DeleteTrash(ids ...string) error
+	HideNames(n *NameCipher) error
+	SetBound() error
 	Close() error
 }
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound = errors.New("not found")
+	ErrReserved = errors.New("reserved name")
+)
+
+// Buckets for our own use have names that aren't allowed for
+// realms, and are never listed as realms. (Only these names are
+// reserved, so that realms from before any of them were added,
+// whose names start with a dot, may still be used.)
+const (
+	auditBucket      = ".audit"
+	quarantineBucket = ".quarantine"
+	identityBucket   = ".identity"
+	realmKeyBucket   = ".keys"
+	configBucket     = ".config"
+)
+
+var reserved = map[string]bool{
+	auditBucket:      true,
+	quarantineBucket: true,
+	identityBucket:   true,
+	realmKeyBucket:   true,
+	configBucket:     true,
+	trashBucket:      true,
+}
+
+func isReserved(realm string) bool {
+	return reserved[realm]
+}
+
+func checkRealm(realm string) error {
+	if isReserved(realm) || strings.HasPrefix(realm, hiddenPrefix) {
+		return fmt.Errorf("realm %s: %w", realm, ErrReserved)
+	}
+
+	return nil
+}
 
 type BoltDB struct {
-	db *bolt.DB
+	db    *bolt.DB
+	names *NameCipher // nil unless names are hidden
 }
 
 func NewBoltDB(fpath string) (*BoltDB, error) {
+	return NewBoltDBContext(context.Background(), fpath)
+}
+
+// lockWait is how long each attempt to lock the DB waits
+// before checking whether the context is done.
+const lockWait = 100 * time.Millisecond
+
+// NewBoltDBContext opens the DB, waiting for any other process
+// that has it open (and so locked) until the context is done.
+func NewBoltDBContext(ctx context.Context, fpath string) (*BoltDB, error) {
 	if err := ensureDir(path.Dir(fpath)); err != nil {
 		return nil, err
 	}
 
-	db, err := bolt.Open(fpath, 0600, nil)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("waiting for %s: %w", fpath, err)
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		db, err := bolt.Open(fpath, 0600, &bolt.Options{Timeout: lockWait})
 
-	return &BoltDB{db}, nil
+		if err == bolt.ErrTimeout {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &BoltDB{db: db}, nil
+	}
 }
 
 func (b *BoltDB) Close() error {
@@ -48,58 +126,73 @@ func (b *BoltDB) Close() error {
 }
 
 func (b *BoltDB) GetKey(realm, key string) (s Sealed, err error) {
+	if err = checkRealm(realm); err != nil {
+		return
+	}
+
 	err = b.db.View(func(tx *bolt.Tx) error {
-		bk := tx.Bucket([]byte(realm))
+		bk := b.realmBucket(tx, realm)
 
 		if bk == nil {
 			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
 		}
 
-		v := bk.Get([]byte(key))
+		v := bk.Get([]byte(b.names.KeyID(realm, key)))
 
 		if v == nil {
 			return fmt.Errorf("%s/%s: %w", realm, key, ErrNotFound)
 		}
 
-		return json.Unmarshal(v, &s)
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+
+		s.Name = ""
+		return nil
 	})
 
 	return
 }
 
 func (b *BoltDB) SetKey(realm, key string, s Sealed) error {
-	v, err := json.Marshal(s)
-
-	if err != nil {
+	if err := checkRealm(realm); err != nil {
 		return err
 	}
 
 	return b.db.Update(func(tx *bolt.Tx) error {
-		bk, err := tx.CreateBucketIfNotExists([]byte(realm))
+		bk, err := b.createRealm(tx, realm)
 
 		if err != nil {
 			return err
 		}
 
-		return bk.Put([]byte(key), v)
+		return b.putRecord(bk, realm, key, s)
 	})
 }
 
 func (b *BoltDB) DropKey(realm, key string) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
 	return b.db.Update(func(tx *bolt.Tx) error {
-		bk := tx.Bucket([]byte(realm))
+		bk := b.realmBucket(tx, realm)
 
 		if bk == nil {
 			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
 		}
 
-		return bk.Delete([]byte(key))
+		return bk.Delete([]byte(b.names.KeyID(realm, key)))
 	})
 }
 
 func (b *BoltDB) ListKeys(realm string) (s []string, err error) {
+	if err = checkRealm(realm); err != nil {
+		return
+	}
+
 	err = b.db.Update(func(tx *bolt.Tx) error {
-		bk := tx.Bucket([]byte(realm))
+		bk := b.realmBucket(tx, realm)
 
 		if bk == nil {
 			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
@@ -107,13 +200,8 @@ func (b *BoltDB) ListKeys(realm string) (s []string, err error) {
 
 		s = make([]string, 0)
 
-		// must copy any byte slice to avoid invalid
-		// memory references later; k & v are volatile
-
-		return bk.ForEach(func(k, v []byte) error {
-			c := make([]byte, len(k))
-			copy(c, k)
-			s = append(s, string(c))
+		return b.forEachRecord(bk, func(k string, v []byte) error {
+			s = append(s, k)
 			return nil
 		})
 	})
@@ -129,9 +217,17 @@ func (b *BoltDB) ListRealms() (s []string, err error) {
 		// memory references later; k & v are volatile
 
 		return tx.ForEach(func(k []byte, v *bolt.Bucket) error {
-			c := make([]byte, len(k))
-			copy(c, k)
-			s = append(s, string(c))
+			if isReserved(string(k)) {
+				return nil
+			}
+
+			name, err := b.realmName(k, v)
+
+			if err != nil {
+				return err
+			}
+
+			s = append(s, name)
 			return nil
 		})
 	})
@@ -140,14 +236,35 @@ func (b *BoltDB) ListRealms() (s []string, err error) {
 }
 
 func (b *BoltDB) Purge(realm string) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	// the realm's data key goes with it, so that a new realm
+	// of the same name doesn't inherit it
+
 	return b.db.Update(func(tx *bolt.Tx) error {
-		return tx.DeleteBucket([]byte(realm))
+		id := []byte(b.names.RealmID(realm))
+
+		if err := tx.DeleteBucket(id); err != nil {
+			return err
+		}
+
+		if kb := tx.Bucket([]byte(realmKeyBucket)); kb != nil {
+			return kb.Delete(id)
+		}
+
+		return nil
 	})
 }
 
 func (b *BoltDB) GetAllKeys(realm string) (s Stored, err error) {
+	if err = checkRealm(realm); err != nil {
+		return
+	}
+
 	err = b.db.View(func(tx *bolt.Tx) error {
-		bk := tx.Bucket([]byte(realm))
+		bk := b.realmBucket(tx, realm)
 
 		if bk == nil {
 			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
@@ -155,20 +272,15 @@ func (b *BoltDB) GetAllKeys(realm string) (s Stored, err error) {
 
 		s = make(Stored)
 
-		// must copy any byte slice to avoid invalid
-		// memory references later; k & v are volatile
-
-		return bk.ForEach(func(k, v []byte) error {
-			c := make([]byte, len(k))
-			copy(c, k)
-
+		return b.forEachRecord(bk, func(k string, v []byte) error {
 			var sd Sealed
 
 			if err := json.Unmarshal(v, &sd); err != nil {
 				return err
 			}
 
-			s[string(c)] = sd
+			sd.Name = ""
+			s[k] = sd
 			return nil
 		})
 	})
@@ -177,25 +289,688 @@ func (b *BoltDB) GetAllKeys(realm string) (s Stored, err error) {
 }
 
 func (b *BoltDB) SetKeys(realm string, s Stored) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
 	return b.db.Update(func(tx *bolt.Tx) error {
-		bk, err := tx.CreateBucketIfNotExists([]byte(realm))
+		bk, err := b.createRealm(tx, realm)
 
 		if err != nil {
 			return err
 		}
 
 		for k, sd := range s {
-			v, err := json.Marshal(sd)
+			if err = b.putRecord(bk, realm, k, sd); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetRealmKey returns the realm's (sealed) data key.
+func (b *BoltDB) GetRealmKey(realm string) (s Sealed, err error) {
+	if err = checkRealm(realm); err != nil {
+		return
+	}
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(realmKeyBucket))
+
+		if bk == nil {
+			return fmt.Errorf("key for %s: %w", realm, ErrNotFound)
+		}
+
+		v := bk.Get([]byte(b.names.RealmID(realm)))
+
+		if v == nil {
+			return fmt.Errorf("key for %s: %w", realm, ErrNotFound)
+		}
+
+		return json.Unmarshal(v, &s)
+	})
+
+	return
+}
+
+// SetRealmKey stores the realm's data key along with records
+// sealed under it, all at once, so that the realm's records are
+// never left sealed under a key that's not (yet) stored.
+func (b *BoltDB) SetRealmKey(realm string, key Sealed, records Stored) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	kv, err := json.Marshal(key)
+
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		kb, err := tx.CreateBucketIfNotExists([]byte(realmKeyBucket))
+
+		if err != nil {
+			return err
+		}
+
+		if err = kb.Put([]byte(b.names.RealmID(realm)), kv); err != nil {
+			return err
+		}
+
+		bk, err := b.createRealm(tx, realm)
+
+		if err != nil {
+			return err
+		}
+
+		for k, sd := range records {
+			if err = b.putRecord(bk, realm, k, sd); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Rewrap is everything that's sealed under, or derived from,
+// the secret key, redone for a new one (see BoltDB.Rewrap).
+type Rewrap struct {
+	RealmKeys Stored            // every realm's data key
+	Identity  *Sealed           // the sharing keypair, if there is one
+	Trash     map[string]Sealed // every item in the trash, by ID
+	Names     *NameCipher       // if names are hidden
+	AuditKey  []byte
+}
+
+// Rewrap moves the DB to a new secret key all at once: the data
+// keys, identity, and trash are replaced with those resealed under
+// the new key, names are hidden again with its cipher, and the
+// audit log is signed again with its key (so the log should be
+// verified first, or tampering would go unnoticed from then on).
+// The DB file is then rewritten, so nothing sealed under the old
+// key lingers in free pages.
+func (b *BoltDB) Rewrap(r Rewrap) error {
+	keys := make(map[string][]byte, len(r.RealmKeys))
+
+	for realm, key := range r.RealmKeys {
+		if err := checkRealm(realm); err != nil {
+			return err
+		}
+
+		kv, err := json.Marshal(key)
+
+		if err != nil {
+			return err
+		}
+
+		keys[realm] = kv
+	}
+
+	var identity []byte
+
+	if r.Identity != nil {
+		v, err := json.Marshal(r.Identity)
+
+		if err != nil {
+			return err
+		}
+
+		identity = v
+	}
+
+	hidden, err := b.NamesHidden()
+
+	if err != nil {
+		return err
+	} else if hidden && r.Names == nil {
+		return errors.New("names are hidden: no cipher")
+	}
+
+	old := b.names
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		// everything's read with the old names before any
+		// of it is written with the new ones
+
+		realms, err := b.readRealms(tx)
+
+		if err != nil {
+			return err
+		}
+
+		quarantined, err := b.readQuarantine(tx)
+
+		if err != nil {
+			return err
+		}
+
+		entries, err := b.readAuditLog(tx)
+
+		if err != nil {
+			return err
+		}
+
+		if hidden {
+			b.names = r.Names
+		}
+
+		for realm, records := range realms {
+			if _, ok := keys[realm]; !ok {
+				return fmt.Errorf("key for %s: %w", realm, ErrNotFound)
+			}
+
+			if hidden {
+				if err = b.rehideRealm(tx, old, realm, records); err != nil {
+					return fmt.Errorf("realm %s: %w", realm, err)
+				}
+			}
+		}
+
+		if hidden {
+			if err = b.rehideQuarantine(tx, quarantined); err != nil {
+				return err
+			}
+		}
+
+		if err = b.putRealmKeys(tx, keys); err != nil {
+			return err
+		}
+
+		if identity != nil {
+			if err = putIdentity(tx, identity); err != nil {
+				return err
+			}
+		}
+
+		if err = b.putTrash(tx, r.Trash); err != nil {
+			return err
+		}
+
+		return b.resignAuditLog(tx, entries, r.AuditKey)
+	})
+
+	if err != nil {
+		b.names = old
+		return err
+	}
+
+	return b.compact()
+}
+
+// putRealmKeys replaces all the data keys.
+func (b *BoltDB) putRealmKeys(tx *bolt.Tx, keys map[string][]byte) error {
+	if tx.Bucket([]byte(realmKeyBucket)) != nil {
+		if err := tx.DeleteBucket([]byte(realmKeyBucket)); err != nil {
+			return err
+		}
+	}
+
+	kb, err := tx.CreateBucket([]byte(realmKeyBucket))
+
+	if err != nil {
+		return err
+	}
+
+	for realm, kv := range keys {
+		if err = kb.Put([]byte(b.names.RealmID(realm)), kv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putTrash replaces every item in the trash; an item that's
+// left out would be lost, as it can't be unsealed any more.
+func (b *BoltDB) putTrash(tx *bolt.Tx, items map[string]Sealed) error {
+	tb := tx.Bucket([]byte(trashBucket))
+
+	if tb == nil {
+		if len(items) > 0 {
+			return fmt.Errorf("trash: %w", ErrNotFound)
+		}
+
+		return nil
+	}
+
+	if n := tb.Stats().KeyN; n != len(items) {
+		return fmt.Errorf("trash has %d items, not %d", n, len(items))
+	}
+
+	for id, item := range items {
+		if tb.Get([]byte(id)) == nil {
+			return fmt.Errorf("trash %s: %w", id, ErrNotFound)
+		}
+
+		v, err := json.Marshal(item)
+
+		if err != nil {
+			return err
+		}
+
+		if err = tb.Put([]byte(id), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetIdentity returns the user's (sealed) sharing keypair.
+func (b *BoltDB) GetIdentity() (s Sealed, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bk := tx.Bucket([]byte(identityBucket))
+
+		if bk == nil {
+			return fmt.Errorf("identity: %w", ErrNotFound)
+		}
+
+		v := bk.Get([]byte("x25519"))
+
+		if v == nil {
+			return fmt.Errorf("identity: %w", ErrNotFound)
+		}
+
+		return json.Unmarshal(v, &s)
+	})
+
+	return
+}
+
+func (b *BoltDB) SetIdentity(s Sealed) error {
+	v, err := json.Marshal(s)
+
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putIdentity(tx, v)
+	})
+}
+
+func putIdentity(tx *bolt.Tx, v []byte) error {
+	bk, err := tx.CreateBucketIfNotExists([]byte(identityBucket))
+
+	if err != nil {
+		return err
+	}
+
+	return bk.Put([]byte("x25519"), v)
+}
+
+// boundKey marks a DB in which every record has been sealed
+// bound to its realm & key (see Sealer.Bound).
+const boundKey = "bound"
+
+// IsBound reports whether SetBound has been run on the DB.
+func (b *BoltDB) IsBound() (bound bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if cb := tx.Bucket([]byte(configBucket)); cb != nil {
+			bound = cb.Get([]byte(boundKey)) != nil
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// SetBound marks the DB once every record has been resealed
+// in the bound format; it can't be unset.
+func (b *BoltDB) SetBound() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		cb, err := tx.CreateBucketIfNotExists([]byte(configBucket))
+
+		if err != nil {
+			return err
+		}
+
+		return cb.Put([]byte(boundKey), []byte("bound"))
+	})
+}
+
+// Check runs Bolt's own consistency check, returning
+// the first problem (if any).
+func (b *BoltDB) Check() error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Quarantine moves a record that can't be read into a bucket
+// where it's out of the way (but not lost), keyed by realm/key.
+func (b *BoltDB) Quarantine(realm, key string) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := b.realmBucket(tx, realm)
+
+		if bk == nil {
+			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
+		}
+
+		id := []byte(b.names.KeyID(realm, key))
+		v := bk.Get(id)
+
+		if v == nil {
+			return fmt.Errorf("%s/%s: %w", realm, key, ErrNotFound)
+		}
+
+		qb, err := tx.CreateBucketIfNotExists([]byte(quarantineBucket))
+
+		if err != nil {
+			return err
+		}
+
+		if err = b.putQuarantined(qb, realm+"/"+key, v); err != nil {
+			return err
+		}
+
+		return bk.Delete(id)
+	})
+}
+
+// auditHeadKey holds the audit log's head in the config bucket.
+const auditHeadKey = "audit-head"
+
+// AppendAudit adds entries to the audit log, chaining each
+// to the one before and signing it with the key, and moves
+// the head to the last one. The chain goes on from the head,
+// so that entries removed from the end still show as missing;
+// a head that's been altered is left as it is, for the same
+// reason.
+func (b *BoltDB) AppendAudit(key []byte, entries ...AuditEntry) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists([]byte(auditBucket))
+
+		if err != nil {
+			return err
+		}
+
+		cb, err := tx.CreateBucketIfNotExists([]byte(configBucket))
+
+		if err != nil {
+			return err
+		}
+
+		head, err := getAuditHead(cb)
+
+		if err != nil {
+			return err
+		}
+
+		var prev string
+
+		seq := bk.Sequence()
+		valid := head == nil || head.Valid(key)
+
+		if head != nil && valid {
+			seq, prev = head.Seq, head.MAC
+		} else if _, v := bk.Cursor().Last(); v != nil {
+			var last AuditEntry
+
+			if err = json.Unmarshal(v, &last); err != nil {
+				return err
+			}
+
+			prev = last.MAC
+		}
+
+		for _, a := range entries {
+			seq++
+
+			a.Seq = seq
+			a.Prev = prev
+			a.Headed = true
+			a.MAC = a.Sign(key)
+			prev = a.MAC
+
+			// the MAC covers the names, hidden or not
+
+			if a, err = b.hideAudit(a); err != nil {
+				return err
+			}
+
+			v, err := json.Marshal(a)
+
 			if err != nil {
 				return err
 			}
-			if err = bk.Put([]byte(k), v); err != nil {
+
+			if err = bk.Put(seqKey(a.Seq), v); err != nil {
 				return err
 			}
 		}
 
+		if err = bk.SetSequence(seq); err != nil || !valid {
+			return err
+		}
+
+		h := AuditHead{Seq: seq, MAC: prev}
+		h.Sig = h.Sign(key)
+
+		v, err := json.Marshal(h)
+
+		if err != nil {
+			return err
+		}
+
+		return cb.Put([]byte(auditHeadKey), v)
+	})
+}
+
+// getAuditHead returns the audit log's head, or nil if
+// there's none (yet).
+func getAuditHead(cb *bolt.Bucket) (*AuditHead, error) {
+	v := cb.Get([]byte(auditHeadKey))
+
+	if v == nil {
+		return nil, nil
+	}
+
+	var h AuditHead
+
+	if err := json.Unmarshal(v, &h); err != nil {
+		return nil, fmt.Errorf("audit head: %w", err)
+	}
+
+	return &h, nil
+}
+
+// ListAudit returns all the audit entries in order, along with
+// the head (or, for an older log, the last sequence number issued).
+func (b *BoltDB) ListAudit() (s []AuditEntry, head AuditHead, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if bk := tx.Bucket([]byte(auditBucket)); bk != nil {
+			head.Seq = bk.Sequence()
+		}
+
+		if cb := tx.Bucket([]byte(configBucket)); cb != nil {
+			h, err := getAuditHead(cb)
+
+			if err != nil {
+				return err
+			} else if h != nil {
+				head = *h
+			}
+		}
+
+		s, err = b.readAuditLog(tx)
+		return err
+	})
+
+	return
+}
+
+// readAuditLog returns the audit entries in order, as signed.
+func (b *BoltDB) readAuditLog(tx *bolt.Tx) ([]AuditEntry, error) {
+	s := make([]AuditEntry, 0)
+	bk := tx.Bucket([]byte(auditBucket))
+
+	if bk == nil {
+		return s, nil
+	}
+
+	err := bk.ForEach(func(k, v []byte) error {
+		var a AuditEntry
+
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+
+		a, err := b.showAudit(a)
+
+		if err != nil {
+			return err
+		}
+
+		s = append(s, a)
 		return nil
 	})
+
+	return s, err
+}
+
+// resignAuditLog replaces the audit log with the entries chained
+// and signed again with the key (as they would have been, had it
+// been the key all along), along with a new head.
+func (b *BoltDB) resignAuditLog(tx *bolt.Tx, entries []AuditEntry, key []byte) error {
+	bk := tx.Bucket([]byte(auditBucket))
+
+	if bk == nil {
+		return nil
+	}
+
+	var prev string
+
+	for _, a := range entries {
+		a.Prev = prev
+		a.Headed = true
+		a.MAC = a.Sign(key)
+		prev = a.MAC
+
+		a, err := b.hideAudit(a)
+
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(a)
+
+		if err != nil {
+			return err
+		}
+
+		if err = bk.Put(seqKey(a.Seq), v); err != nil {
+			return err
+		}
+	}
+
+	cb, err := tx.CreateBucketIfNotExists([]byte(configBucket))
+
+	if err != nil {
+		return err
+	}
+
+	h := AuditHead{Seq: bk.Sequence(), MAC: prev}
+	h.Sig = h.Sign(key)
+
+	v, err := json.Marshal(h)
+
+	if err != nil {
+		return err
+	}
+
+	return cb.Put([]byte(auditHeadKey), v)
+}
+
+// compact rewrites the DB into a new file, so that nothing is
+// left behind in its free pages (e.g., names that were hidden).
+func (b *BoltDB) compact() error {
+	fpath := b.db.Path()
+	tmp := fpath + ".compact"
+
+	_ = os.Remove(tmp)
+
+	ndb, err := bolt.Open(tmp, 0600, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		return ndb.Update(func(ntx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, bk *bolt.Bucket) error {
+				nb, err := ntx.CreateBucket(name)
+
+				if err != nil {
+					return err
+				}
+
+				return copyBucket(nb, bk)
+			})
+		})
+	})
+
+	if cerr := ndb.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err = b.db.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, fpath); err != nil {
+		return err
+	}
+
+	b.db, err = bolt.Open(fpath, 0600, nil)
+	return err
+}
+
+// copyBucket copies a bucket's records, sequence, and any
+// buckets nested in it (whose value is nil in ForEach).
+func copyBucket(nb, bk *bolt.Bucket) error {
+	if err := nb.SetSequence(bk.Sequence()); err != nil {
+		return err
+	}
+
+	return bk.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nb.Put(k, v)
+		}
+
+		sub, err := nb.CreateBucket(k)
+
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(sub, bk.Bucket(k))
+	})
+}
+
+// seqKey makes keys that sort in numeric order.
+func seqKey(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
 }
 
 func ensureDir(path string) error {
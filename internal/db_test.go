@@ -1,12 +1,16 @@
 package internal
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
 )
 
 func TestBoltDBOps(t *testing.T) { //nolint:gocyclo
@@ -155,6 +159,63 @@ func TestBoltDBOps(t *testing.T) { //nolint:gocyclo
 		t.Errorf("invalid realms: %#v", l3)
 	}
 
+	if _, err := db2.GetRealmKey("top4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error for no realm key: %v", err)
+	}
+
+	k := Sealed{Data: "key", Meta: "metadata"}
+
+	if err := db2.SetRealmKey("top4", k, x); err != nil {
+		t.Fatal("set realm key", err)
+	}
+
+	if k2, err := db2.GetRealmKey("top4"); err != nil || !reflect.DeepEqual(k, k2) {
+		t.Errorf("invalid realm key: %#v %v", k2, err)
+	}
+
+	if x2, err := db2.GetAllKeys("top4"); err != nil || !reflect.DeepEqual(x, x2) {
+		t.Errorf("invalid realm key set: %#v %v", x2, err)
+	}
+
+	if l4, err := db2.ListRealms(); err != nil || len(l4) != 3 {
+		t.Errorf("invalid realms: %#v %v", l4, err)
+	}
+
+	// rewrapping is all or nothing, and every realm needs a key
+
+	k3 := Sealed{Data: "key3", Meta: "metadata"}
+	id := Sealed{Data: "identity"}
+
+	if err := db2.Rewrap(Rewrap{RealmKeys: Stored{"top4": k3, "top": k3}, Identity: &id}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error for no realm key: %v", err)
+	}
+
+	if k2, err := db2.GetRealmKey("top4"); err != nil || !reflect.DeepEqual(k, k2) {
+		t.Errorf("realm key replaced: %#v %v", k2, err)
+	}
+
+	if _, err := db2.GetIdentity(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("identity replaced: %v", err)
+	}
+
+	if err := db2.Rewrap(Rewrap{RealmKeys: Stored{"top4": k3, "top": k3, "top3": k3}, Identity: &id}); err != nil {
+		t.Fatal("rewrap", err)
+	}
+
+	for _, r := range []string{"top", "top3", "top4"} {
+		if k2, err := db2.GetRealmKey(r); err != nil || !reflect.DeepEqual(k3, k2) {
+			t.Errorf("invalid realm key for %s: %#v %v", r, k2, err)
+		}
+	}
+
+	if id2, err := db2.GetIdentity(); err != nil || !reflect.DeepEqual(id, id2) {
+		t.Errorf("invalid identity: %#v %v", id2, err)
+	}
+
+	if x2, err := db2.GetAllKeys("top4"); err != nil || !reflect.DeepEqual(x, x2) {
+		t.Errorf("invalid realm key set after rewrap: %#v %v", x2, err)
+	}
+
 	db2.Close()
 }
 
@@ -192,3 +253,114 @@ func TestEnsureDir(t *testing.T) {
 
 	t.Logf("%s perms are %o4", p2, fi.Mode())
 }
+
+func TestBoltDBLocked(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	fpath := path.Join(dname, "/enty")
+	db, err := NewBoltDB(fpath)
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	if _, err = NewBoltDBContext(ctx, fpath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("invalid error while locked: %v", err)
+	}
+
+	// once it's closed, a waiting open goes ahead
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		db.Close()
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db2, err := NewBoltDBContext(ctx, fpath)
+
+	if err != nil {
+		t.Fatal("newdb 2", err)
+	}
+
+	db2.Close()
+}
+
+func TestBoltDBCompact(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "/envy.db"))
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer func() { db.Close() }()
+
+	if err = db.SetKey("~top", "a", Sealed{Data: "a"}); !errors.Is(err, ErrReserved) {
+		t.Errorf("set in hidden realm name: %v", err)
+	}
+
+	if err = db.SetKey("top", "a", Sealed{Data: "a"}); err != nil {
+		t.Fatal("set", err)
+	}
+
+	// a bucket nested in a realm's bucket, which is copied with
+	// its own records and sequence
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		sub, err := tx.Bucket([]byte("top")).CreateBucket([]byte("nested"))
+
+		if err != nil {
+			return err
+		}
+
+		if err = sub.SetSequence(7); err != nil {
+			return err
+		}
+
+		return sub.Put([]byte("b"), []byte("b"))
+	})
+
+	if err != nil {
+		t.Fatal("nest", err)
+	}
+
+	if err = db.compact(); err != nil {
+		t.Fatal("compact", err)
+	}
+
+	if s, err := db.GetKey("top", "a"); err != nil || s.Data != "a" {
+		t.Errorf("invalid key after compact: %v %v", s, err)
+	}
+
+	err = db.db.View(func(tx *bolt.Tx) error {
+		sub := tx.Bucket([]byte("top")).Bucket([]byte("nested"))
+
+		if sub == nil || sub.Sequence() != 7 || string(sub.Get([]byte("b"))) != "b" {
+			return errors.New("nested bucket not copied")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+}
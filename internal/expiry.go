@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration extends time.ParseDuration to allow whole
+// days ("14d") and weeks ("2w"), which is how expiry and
+// rotation periods are usually thought of.
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		return time.Duration(n) * unit, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// ParseTime takes either a date (in local time) or
+// a full RFC 3339 timestamp.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// Expiry returns when the value expires, either at a fixed
+// time or some time after it was last modified; it's zero if
+// the value never expires.
+func (md metadata) Expiry() time.Time {
+	switch {
+	case md.Expires != 0:
+		return time.Unix(md.Expires, 0)
+	case md.MaxAge != 0:
+		return time.Unix(md.Modified+md.MaxAge, 0)
+	}
+
+	return time.Time{}
+}
+
+// DaysLeft describes the time remaining before expiry,
+// if there is an expiry.
+func DaysLeft(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := time.Until(t)
+
+	if d <= 0 {
+		return "expired"
+	}
+
+	// rounding up, so a value that expires later today
+	// still has 1 day left rather than 0
+
+	return fmt.Sprintf("%dd left", int(math.Ceil(d.Hours()/24)))
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	table := []struct {
+		in  string
+		out time.Duration
+		err bool
+	}{
+		{"14d", 14 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"xd", 0, true},
+		{"14", 0, true},
+	}
+
+	for _, tc := range table {
+		d, err := ParseDuration(tc.in)
+
+		if (err != nil) != tc.err {
+			t.Errorf("%s: invalid err %v", tc.in, err)
+		} else if d != tc.out {
+			t.Errorf("%s: invalid duration %v", tc.in, d)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	if _, err := ParseTime("2020-10-11"); err != nil {
+		t.Error("date", err)
+	}
+
+	if tm, err := ParseTime("2020-10-11T23:28:05-06:00"); err != nil {
+		t.Error("rfc3339", err)
+	} else if tm.Unix() != 1602480485 {
+		t.Errorf("invalid time: %v", tm)
+	}
+
+	if _, err := ParseTime("10/11/2020"); err == nil {
+		t.Error("no error")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Now().Unix()
+
+	if e := (metadata{Modified: now}).Expiry(); !e.IsZero() {
+		t.Errorf("should not expire: %v", e)
+	}
+
+	if e := (metadata{Modified: now, MaxAge: 3600}).Expiry(); e.Unix() != now+3600 {
+		t.Errorf("invalid max-age expiry: %v", e)
+	}
+
+	if e := (metadata{Modified: now, MaxAge: 3600, Expires: now + 60}).Expiry(); e.Unix() != now+60 {
+		t.Errorf("invalid fixed expiry: %v", e)
+	}
+
+	if s := DaysLeft(time.Now().Add(-time.Hour)); s != "expired" {
+		t.Errorf("invalid days left: %s", s)
+	}
+
+	if s := DaysLeft(time.Now().Add(50 * time.Hour)); s != "3d left" {
+		t.Errorf("invalid days left: %s", s)
+	}
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ErrKeyClash    = errors.New("key clashes with another")
+	ErrNotAnObject = errors.New("document isn't an object")
+)
+
+// TypeKey and ValueKey make up an object that's one value of
+// a type JSON doesn't have (e.g., binary), which is a leaf
+// rather than more keys.
+const (
+	TypeKey  = "$type"
+	ValueKey = "$value"
+)
+
+// IsTyped reports whether an object is one typed value.
+func IsTyped(m map[string]interface{}) bool {
+	_, t := m[TypeKey]
+	_, v := m[ValueKey]
+
+	return len(m) == 2 && t && v
+}
+
+// Flatten turns a nested document (as decoded from JSON or YAML)
+// into leaf values keyed by their path, joined with sep and upper-
+// cased if upper is set. Arrays, typed values (and empty objects)
+// are leaves.
+func Flatten(doc map[string]interface{}, sep string, upper bool) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	if err := flatten(result, "", doc, sep, upper); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func flatten(result map[string]interface{}, prefix string, doc map[string]interface{}, sep string, upper bool) error {
+	for k, v := range doc {
+		if upper {
+			k = strings.ToUpper(k)
+		}
+
+		if prefix != "" {
+			k = prefix + sep + k
+		}
+
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 && !IsTyped(sub) {
+			if err := flatten(result, k, sub, sep, upper); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, ok := result[k]; ok {
+			return fmt.Errorf("%s: %w", k, ErrKeyClash)
+		}
+
+		result[k] = v
+	}
+
+	return nil
+}
+
+// node is an object made by Nest, as opposed to an
+// object that's a value in its own right.
+type node map[string]interface{}
+
+// Nest reverses Flatten, splitting keys on sep (and lower-
+// casing each part if lower is set).
+func Nest(values map[string]interface{}, sep string, lower bool) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(values))
+
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	root := make(node)
+
+	for _, k := range keys {
+		parts := strings.Split(k, sep)
+		n := root
+
+		for i, p := range parts {
+			if lower {
+				p = strings.ToLower(p)
+			}
+
+			next, ok := n[p]
+
+			if i == len(parts)-1 {
+				if ok {
+					return nil, fmt.Errorf("%s: %w", k, ErrKeyClash)
+				}
+
+				n[p] = values[k]
+				break
+			}
+
+			if !ok {
+				next = make(node)
+				n[p] = next
+			}
+
+			if n, ok = next.(node); !ok {
+				return nil, fmt.Errorf("%s: %w", k, ErrKeyClash)
+			}
+		}
+	}
+
+	return root.plain(), nil
+}
+
+// plain converts nodes back to ordinary objects.
+func (n node) plain() map[string]interface{} {
+	result := make(map[string]interface{}, len(n))
+
+	for k, v := range n {
+		if sub, ok := v.(node); ok {
+			v = sub.plain()
+		}
+
+		result[k] = v
+	}
+
+	return result
+}
+
+// DecodeJSON reads a JSON object, keeping numbers as they're
+// written (as json.Number).
+func DecodeJSON(b []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if doc == nil {
+		return nil, ErrNotAnObject
+	}
+
+	return doc, nil
+}
+
+// DecodeYAML reads a YAML mapping as JSON would be decoded,
+// i.e., with string keys throughout.
+func DecodeYAML(b []byte) (map[string]interface{}, error) {
+	var v interface{}
+
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	doc, ok := fromYAML(v).(map[string]interface{})
+
+	if !ok {
+		return nil, ErrNotAnObject
+	}
+
+	return doc, nil
+}
+
+func fromYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+
+		for k, e := range x {
+			m[fmt.Sprint(k)] = fromYAML(e)
+		}
+
+		return m
+
+	case []interface{}:
+		for i, e := range x {
+			x[i] = fromYAML(e)
+		}
+	}
+
+	return v
+}
+
+// EncodeYAML writes a document as YAML, with numbers from
+// DecodeJSON as numbers rather than strings.
+func EncodeYAML(doc map[string]interface{}) ([]byte, error) {
+	return yaml.Marshal(toYAML(doc))
+}
+
+func toYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+
+		for k, e := range x {
+			m[k] = toYAML(e)
+		}
+
+		return m
+
+	case []interface{}:
+		l := make([]interface{}, len(x))
+
+		for i, e := range x {
+			l[i] = toYAML(e)
+		}
+
+		return l
+
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+
+		if f, err := x.Float64(); err == nil {
+			return f
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	doc, err := DecodeJSON([]byte(`{"db": {"host": "h", "port": 5432, "opts": {}}, "tags": ["a"], "debug": false}`))
+
+	if err != nil {
+		t.Fatal("decode", err)
+	}
+
+	flat, err := Flatten(doc, ".", false)
+
+	if err != nil {
+		t.Fatal("flatten", err)
+	}
+
+	exp := map[string]interface{}{
+		"db.host": "h",
+		"db.port": json.Number("5432"),
+		"db.opts": map[string]interface{}{},
+		"tags":    []interface{}{"a"},
+		"debug":   false,
+	}
+
+	if !reflect.DeepEqual(flat, exp) {
+		t.Errorf("invalid flat: %#v", flat)
+	}
+
+	nested, err := Nest(flat, ".", false)
+
+	if err != nil {
+		t.Fatal("nest", err)
+	}
+
+	if !reflect.DeepEqual(nested, doc) {
+		t.Errorf("invalid nested: %#v", nested)
+	}
+
+	if _, err = Flatten(map[string]interface{}{"a": map[string]interface{}{"b": 1}, "a.b": 2}, ".", false); !errors.Is(err, ErrKeyClash) {
+		t.Errorf("invalid flatten clash: %v", err)
+	}
+
+	if _, err = Nest(map[string]interface{}{"a": 1, "a.b": 2}, ".", false); !errors.Is(err, ErrKeyClash) {
+		t.Errorf("invalid nest clash: %v", err)
+	}
+
+	// an object that's a value isn't merged with nested keys
+
+	if _, err = Nest(map[string]interface{}{"a": map[string]interface{}{"c": 1}, "a.b": 2}, ".", false); !errors.Is(err, ErrKeyClash) {
+		t.Errorf("invalid nest clash with object: %v", err)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	doc, err := DecodeYAML([]byte("a:\n  1: one\n  list:\n  - x: 2\nb: 1.5\n"))
+
+	if err != nil {
+		t.Fatal("decode", err)
+	}
+
+	exp := map[string]interface{}{
+		"a": map[string]interface{}{
+			"1":    "one",
+			"list": []interface{}{map[string]interface{}{"x": 2}},
+		},
+		"b": 1.5,
+	}
+
+	if !reflect.DeepEqual(doc, exp) {
+		t.Errorf("invalid doc: %#v", doc)
+	}
+
+	if _, err = DecodeYAML([]byte("- a\n- b\n")); !errors.Is(err, ErrNotAnObject) {
+		t.Errorf("invalid list: %v", err)
+	}
+
+	b, err := EncodeYAML(map[string]interface{}{"count": json.Number("7"), "f": json.Number("0.5")})
+
+	if err != nil || string(b) != "count: 7\nf: 0.5\n" {
+		t.Errorf("invalid encoding: %q %v", b, err)
+	}
+}
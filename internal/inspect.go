@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Inspection describes a value that's a JWT or a PEM
+// certificate (chain), which carry their own expiry.
+type Inspection struct {
+	Kind    string // "jwt" or "x509"
+	Expires time.Time
+	Subject string
+	Issuer  string
+	Details string // decoded, with any signature redacted
+}
+
+// Summary is a one-line description for listings.
+func (i *Inspection) Summary() string {
+	parts := []string{i.Kind}
+
+	if !i.Expires.IsZero() {
+		parts = append(parts, "exp "+i.Expires.Format(time.RFC3339), DaysLeft(i.Expires))
+	}
+
+	if i.Subject != "" {
+		parts = append(parts, "sub="+i.Subject)
+	}
+
+	if i.Issuer != "" {
+		parts = append(parts, "iss="+i.Issuer)
+	}
+
+	return strings.Join(parts, "  ")
+}
+
+// Inspect returns a description of the value if it's in
+// one of the formats we understand, or nil otherwise.
+func Inspect(v string) *Inspection {
+	v = strings.TrimSpace(v)
+
+	if strings.HasPrefix(v, "-----BEGIN ") {
+		return inspectPEM(v)
+	}
+
+	return inspectJWT(v)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func inspectJWT(v string) *Inspection {
+	parts := strings.Split(v, ".")
+
+	if len(parts) != 3 {
+		return nil
+	}
+
+	var header, claims map[string]interface{}
+
+	if b, err := decodeSegment(parts[0]); err != nil || json.Unmarshal(b, &header) != nil {
+		return nil
+	}
+
+	if _, ok := header["alg"]; !ok {
+		return nil
+	}
+
+	if b, err := decodeSegment(parts[1]); err != nil || json.Unmarshal(b, &claims) != nil {
+		return nil
+	}
+
+	i := Inspection{Kind: "jwt"}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		i.Expires = time.Unix(int64(exp), 0)
+	}
+
+	i.Subject, _ = claims["sub"].(string)
+	i.Issuer, _ = claims["iss"].(string)
+
+	hb, _ := json.MarshalIndent(header, "", "  ")
+	cb, _ := json.MarshalIndent(claims, "", "  ")
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "header: %s\n", hb)
+	fmt.Fprintf(&b, "claims: %s\n", cb)
+
+	for _, k := range []string{"iat", "nbf", "exp"} {
+		if t, ok := claims[k].(float64); ok {
+			fmt.Fprintf(&b, "%s:    %s\n", k, time.Unix(int64(t), 0).Format(time.RFC3339))
+		}
+	}
+
+	sig, _ := decodeSegment(parts[2])
+
+	fmt.Fprintf(&b, "signature: [redacted, %d bytes]\n", len(sig))
+
+	i.Details = b.String()
+	return &i
+}
+
+func inspectPEM(v string) *Inspection {
+	var (
+		i    *Inspection
+		b    strings.Builder
+		rest = []byte(v)
+	)
+
+	for n := 1; ; n++ {
+		var block *pem.Block
+
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			fmt.Fprintf(&b, "[%d] %s: [redacted]\n\n", n, block.Type)
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return nil
+		}
+
+		// the first certificate is the leaf, which
+		// is the one whose expiry matters
+
+		if i == nil {
+			i = &Inspection{
+				Kind:    "x509",
+				Expires: cert.NotAfter,
+				Subject: cert.Subject.String(),
+				Issuer:  cert.Issuer.String(),
+			}
+		}
+
+		fmt.Fprintf(&b, "[%d] certificate\n", n)
+		fmt.Fprintf(&b, "subject:    %s\n", cert.Subject)
+		fmt.Fprintf(&b, "issuer:     %s\n", cert.Issuer)
+		fmt.Fprintf(&b, "serial:     %s\n", cert.SerialNumber)
+		fmt.Fprintf(&b, "not before: %s\n", cert.NotBefore.Format(time.RFC3339))
+		fmt.Fprintf(&b, "not after:  %s (%s)\n", cert.NotAfter.Format(time.RFC3339), DaysLeft(cert.NotAfter))
+
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(&b, "dns names:  %s\n", strings.Join(cert.DNSNames, ", "))
+		}
+
+		if len(cert.EmailAddresses) > 0 {
+			fmt.Fprintf(&b, "emails:     %s\n", strings.Join(cert.EmailAddresses, ", "))
+		}
+
+		if len(cert.IPAddresses) > 0 {
+			ips := make([]string, 0, len(cert.IPAddresses))
+
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+
+			fmt.Fprintf(&b, "ip addrs:   %s\n", strings.Join(ips, ", "))
+		}
+
+		fmt.Fprintf(&b, "is CA:      %t\n", cert.IsCA)
+		fmt.Fprintf(&b, "public key: %s\n", cert.PublicKeyAlgorithm)
+		fmt.Fprintf(&b, "signature:  %s [redacted, %d bytes]\n\n", cert.SignatureAlgorithm, len(cert.Signature))
+	}
+
+	if i == nil {
+		return nil
+	}
+
+	i.Details = strings.TrimSpace(b.String()) + "\n"
+	return i
+}
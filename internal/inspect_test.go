@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJWT uses a token with a fake signature, which is all we need
+func TestJWT(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"matt","iss":"envy","exp":1602480485}`))
+	token := header + "." + claims + ".c2lnbmF0dXJl"
+
+	i := Inspect(token)
+
+	if i == nil {
+		t.Fatal("not a JWT")
+	}
+
+	if i.Kind != "jwt" || i.Subject != "matt" || i.Issuer != "envy" || i.Expires.Unix() != 1602480485 {
+		t.Errorf("invalid inspection: %#v", i)
+	}
+
+	if strings.Contains(i.Details, "c2lnbmF0dXJl") || !strings.Contains(i.Details, "[redacted, 9 bytes]") {
+		t.Errorf("signature not redacted: %s", i.Details)
+	}
+
+	if s := i.Summary(); !strings.HasPrefix(s, "jwt  exp 2020-10-12") || !strings.Contains(s, "expired") {
+		t.Errorf("invalid summary: %s", s)
+	}
+
+	for _, v := range []string{"a.b.c", "abc", header + "." + claims, "e30.e30.e30"} {
+		if i := Inspect(v); i != nil {
+			t.Errorf("%s inspected as %#v", v, i)
+		}
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal("key", err)
+	}
+
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "envy.test"},
+		DNSNames:     []string{"envy.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal("cert", err)
+	}
+
+	v := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	v += string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not really")}))
+
+	i := Inspect(v)
+
+	if i == nil {
+		t.Fatal("not a certificate")
+	}
+
+	t.Log("\n" + i.Details)
+
+	if i.Kind != "x509" || i.Subject != "CN=envy.test" || !i.Expires.Equal(notAfter) {
+		t.Errorf("invalid inspection: %#v", i)
+	}
+
+	if !strings.Contains(i.Details, "dns names:  envy.test") || !strings.Contains(i.Details, "PRIVATE KEY: [redacted]") {
+		t.Errorf("invalid details: %s", i.Details)
+	}
+
+	if strings.Contains(i.Details, "bm90IHJlYWxseQ") {
+		t.Errorf("private key shown: %s", i.Details)
+	}
+
+	if i := Inspect("-----BEGIN CERTIFICATE-----\nxx\n-----END CERTIFICATE-----\n"); i != nil {
+		t.Errorf("bad PEM inspected as %#v", i)
+	}
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadReference = errors.New("invalid reference")
+
+// Expand replaces each reference in a value, ${KEY} for a key in
+// the same realm or ${realm/KEY} for one in another, with what
+// lookup returns for it; "$${" is a literal "${".
+func Expand(s, realm string, lookup func(realm, key string) (string, error)) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.Index(s, "${")
+
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+
+		j := strings.IndexByte(s[i:], '}')
+
+		if j < 0 {
+			return "", fmt.Errorf("%q isn't closed: %w", s[i:], ErrBadReference)
+		}
+
+		r, k := realm, s[i+2:i+j]
+
+		if n := strings.LastIndexByte(k, '/'); n >= 0 {
+			r, k = k[:n], k[n+1:]
+		}
+
+		if r == "" || k == "" {
+			return "", fmt.Errorf("%q: %w", s[i:i+j+1], ErrBadReference)
+		}
+
+		v, err := lookup(r, k)
+
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(s[:i])
+		b.WriteString(v)
+		s = s[i+j+1:]
+	}
+}
@@ -0,0 +1,601 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// hiddenPrefix starts the bucket names of hidden realms, so
+	// it's not allowed in realm names (see checkRealm).
+	hiddenPrefix = "~"
+
+	// realmNameKey holds a hidden realm's (sealed) name in its
+	// bucket; it can't clash with a record's key, which is hex.
+	realmNameKey = "."
+
+	namesKey = "names"
+)
+
+// NameCipher hides realm and key names in the DB: buckets and
+// records are identified by keyed HMACs of the names, and the
+// names themselves are stored encrypted. A nil NameCipher leaves
+// names as they are.
+type NameCipher struct {
+	idKey   []byte
+	sealKey []byte
+}
+
+func NewNameCipher(s *Sealer) (*NameCipher, error) {
+	idKey, err := s.SubKey("name-ids")
+
+	if err != nil {
+		return nil, err
+	}
+
+	sealKey, err := s.SubKey("name-seal")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &NameCipher{idKey: idKey, sealKey: sealKey}, nil
+}
+
+func (n *NameCipher) hash(parts ...string) string {
+	mac := hmac.New(sha256.New, n.idKey)
+
+	// length-prefixed, so the parts can't run together
+
+	for _, p := range parts {
+		fmt.Fprintf(mac, "%d:%s/", len(p), p)
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RealmID returns the bucket name for a realm.
+func (n *NameCipher) RealmID(realm string) string {
+	if n == nil {
+		return realm
+	}
+
+	return hiddenPrefix + n.hash("realm", realm)
+}
+
+// KeyID returns the record's key within its realm's bucket;
+// it depends on the realm, so the same key in two realms
+// can't be matched up.
+func (n *NameCipher) KeyID(realm, key string) string {
+	if n == nil {
+		return key
+	}
+
+	return n.hash("key", realm, key)
+}
+
+// Seal encrypts a name, bound to its ID.
+func (n *NameCipher) Seal(id, name string) (string, error) {
+	nonce, err := realNonce{}.GetNonce()
+
+	if err != nil {
+		return "", err
+	}
+
+	ct, err := gcmSeal(n.sealKey, nonce, []byte(name), []byte(id))
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// Open decrypts a name from Seal.
+func (n *NameCipher) Open(id, sealed string) (string, error) {
+	ct, err := base64.StdEncoding.DecodeString(sealed)
+
+	if err != nil {
+		return "", err
+	}
+
+	pt, err := gcmOpen(n.sealKey, ct, []byte(id))
+
+	if err != nil {
+		return "", fmt.Errorf("name for %s: %w", id, err)
+	}
+
+	return string(pt), nil
+}
+
+// NamesHidden reports whether HideNames has been run on the DB,
+// in which case it must be given a NameCipher with UseNames.
+func (b *BoltDB) NamesHidden() (hidden bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if cb := tx.Bucket([]byte(configBucket)); cb != nil {
+			hidden = cb.Get([]byte(namesKey)) != nil
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// UseNames sets the cipher for a DB whose names are hidden.
+func (b *BoltDB) UseNames(n *NameCipher) {
+	b.names = n
+}
+
+// HideNames moves every realm, and every other place a realm or
+// key name appears, to hidden names, all at once; from then on,
+// the DB must be used with the same NameCipher. The DB file is
+// then rewritten, as the old names would linger in free pages.
+func (b *BoltDB) HideNames(n *NameCipher) error {
+	if hidden, err := b.NamesHidden(); err != nil || hidden {
+		b.names = n
+		return err
+	}
+
+	b.names = n
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		realms := make([]string, 0)
+
+		err := tx.ForEach(func(k []byte, v *bolt.Bucket) error {
+			if !isReserved(string(k)) {
+				realms = append(realms, string(k))
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range realms {
+			if err = b.hideRealm(tx, r); err != nil {
+				return fmt.Errorf("realm %s: %w", r, err)
+			}
+		}
+
+		if err = b.hideRealmKeys(tx); err != nil {
+			return err
+		}
+
+		if err = b.hideQuarantine(tx); err != nil {
+			return err
+		}
+
+		if err = b.hideAuditLog(tx); err != nil {
+			return err
+		}
+
+		cb, err := tx.CreateBucketIfNotExists([]byte(configBucket))
+
+		if err != nil {
+			return err
+		}
+
+		return cb.Put([]byte(namesKey), []byte("hidden"))
+	})
+
+	if err != nil {
+		b.names = nil
+		return err
+	}
+
+	return b.compact()
+}
+
+// collect copies a bucket's contents, so that it may be
+// changed; k & v are only valid during ForEach.
+func collect(bk *bolt.Bucket) (keys, values [][]byte) {
+	_ = bk.ForEach(func(k, v []byte) error {
+		keys = append(keys, append([]byte{}, k...))
+		values = append(values, append([]byte{}, v...))
+		return nil
+	})
+
+	return
+}
+
+func (b *BoltDB) hideRealm(tx *bolt.Tx, realm string) error {
+	keys, values := collect(tx.Bucket([]byte(realm)))
+
+	if err := tx.DeleteBucket([]byte(realm)); err != nil {
+		return err
+	}
+
+	bk, err := b.createRealm(tx, realm)
+
+	if err != nil {
+		return err
+	}
+
+	for i, k := range keys {
+		var s Sealed
+
+		if err := json.Unmarshal(values[i], &s); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+
+		if err = b.putRecord(bk, realm, string(k), s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *BoltDB) hideRealmKeys(tx *bolt.Tx) error {
+	kb := tx.Bucket([]byte(realmKeyBucket))
+
+	if kb == nil {
+		return nil
+	}
+
+	keys, values := collect(kb)
+
+	for i, k := range keys {
+		if err := kb.Delete(k); err != nil {
+			return err
+		}
+
+		if err := kb.Put([]byte(b.names.RealmID(string(k))), values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *BoltDB) hideQuarantine(tx *bolt.Tx) error {
+	qb := tx.Bucket([]byte(quarantineBucket))
+
+	if qb == nil {
+		return nil
+	}
+
+	keys, values := collect(qb)
+
+	for i, k := range keys {
+		if err := qb.Delete(k); err != nil {
+			return err
+		}
+
+		if err := b.putQuarantined(qb, string(k), values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *BoltDB) hideAuditLog(tx *bolt.Tx) error {
+	ab := tx.Bucket([]byte(auditBucket))
+
+	if ab == nil {
+		return nil
+	}
+
+	keys, values := collect(ab)
+
+	for i, k := range keys {
+		var a AuditEntry
+
+		if err := json.Unmarshal(values[i], &a); err != nil {
+			return err
+		}
+
+		a, err := b.hideAudit(a)
+
+		if err != nil {
+			return err
+		}
+
+		v, err := json.Marshal(a)
+
+		if err != nil {
+			return err
+		}
+
+		if err = ab.Put(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// realmBucket returns the realm's bucket, if it exists.
+func (b *BoltDB) realmBucket(tx *bolt.Tx, realm string) *bolt.Bucket {
+	return tx.Bucket([]byte(b.names.RealmID(realm)))
+}
+
+// createRealm returns the realm's bucket, creating it if need
+// be, along with its sealed name if names are hidden.
+func (b *BoltDB) createRealm(tx *bolt.Tx, realm string) (*bolt.Bucket, error) {
+	id := b.names.RealmID(realm)
+	bk, err := tx.CreateBucketIfNotExists([]byte(id))
+
+	if err != nil || b.names == nil || bk.Get([]byte(realmNameKey)) != nil {
+		return bk, err
+	}
+
+	name, err := b.names.Seal(id, realm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bk, bk.Put([]byte(realmNameKey), []byte(name))
+}
+
+// realmName returns the name of the realm in a bucket.
+func (b *BoltDB) realmName(k []byte, bk *bolt.Bucket) (string, error) {
+	if b.names == nil {
+		return string(k), nil
+	}
+
+	return b.names.Open(string(k), string(bk.Get([]byte(realmNameKey))))
+}
+
+// putRecord stores a record by its key's ID, along with
+// the key's sealed name if names are hidden.
+func (b *BoltDB) putRecord(bk *bolt.Bucket, realm, key string, s Sealed) error {
+	id := b.names.KeyID(realm, key)
+	s.Name = ""
+
+	if b.names != nil {
+		var err error
+
+		if s.Name, err = b.names.Seal(id, key); err != nil {
+			return err
+		}
+	}
+
+	v, err := json.Marshal(s)
+
+	if err != nil {
+		return err
+	}
+
+	return bk.Put([]byte(id), v)
+}
+
+// forEachRecord calls f with the name of each record's key,
+// which is copied (unlike v, which is valid only during f).
+func (b *BoltDB) forEachRecord(bk *bolt.Bucket, f func(k string, v []byte) error) error {
+	return bk.ForEach(func(k, v []byte) error {
+		if b.names == nil {
+			return f(string(k), v)
+		}
+
+		if bytes.Equal(k, []byte(realmNameKey)) {
+			return nil
+		}
+
+		var s Sealed
+
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+
+		name, err := b.names.Open(string(k), s.Name)
+
+		if err != nil {
+			return err
+		}
+
+		return f(name, v)
+	})
+}
+
+// putQuarantined stores a record under an ID for its realm/key,
+// with that name sealed in the record if names are hidden.
+func (b *BoltDB) putQuarantined(qb *bolt.Bucket, name string, v []byte) error {
+	if b.names == nil {
+		return qb.Put([]byte(name), v)
+	}
+
+	// the record's unreadable, so it may not even decode;
+	// it's kept as is, along with its sealed realm/key
+
+	id := hiddenPrefix + b.names.hash("quarantine", name)
+	sealed, err := b.names.Seal(id, name)
+
+	if err != nil {
+		return err
+	}
+
+	w, err := json.Marshal(struct {
+		Name   string          `json:"name"`
+		Record json.RawMessage `json:"record"`
+	}{sealed, v})
+
+	if err != nil {
+		return err
+	}
+
+	return qb.Put([]byte(id), w)
+}
+
+func auditID(seq uint64, field string) string {
+	return fmt.Sprintf("audit/%d/%s", seq, field)
+}
+
+// hideAudit encrypts an entry's realm & key, if names are hidden.
+func (b *BoltDB) hideAudit(a AuditEntry) (AuditEntry, error) {
+	if b.names == nil || a.Hidden {
+		return a, nil
+	}
+
+	var err error
+
+	if a.Realm, err = b.names.Seal(auditID(a.Seq, "realm"), a.Realm); err != nil {
+		return a, err
+	}
+
+	if a.Key, err = b.names.Seal(auditID(a.Seq, "key"), a.Key); err != nil {
+		return a, err
+	}
+
+	a.Hidden = true
+	return a, nil
+}
+
+// showAudit reverses hideAudit, restoring the entry as signed.
+func (b *BoltDB) showAudit(a AuditEntry) (AuditEntry, error) {
+	if !a.Hidden {
+		return a, nil
+	}
+
+	if b.names == nil {
+		return a, fmt.Errorf("audit entry %d: names are hidden", a.Seq)
+	}
+
+	var err error
+
+	if a.Realm, err = b.names.Open(auditID(a.Seq, "realm"), a.Realm); err != nil {
+		return a, err
+	}
+
+	if a.Key, err = b.names.Open(auditID(a.Seq, "key"), a.Key); err != nil {
+		return a, err
+	}
+
+	a.Hidden = false
+	return a, nil
+}
+
+// readRealms returns every realm's records by name, e.g., so they
+// can be hidden again with a new cipher.
+func (b *BoltDB) readRealms(tx *bolt.Tx) (map[string]Stored, error) {
+	realms := make(map[string]Stored)
+
+	err := tx.ForEach(func(k []byte, bk *bolt.Bucket) error {
+		if isReserved(string(k)) {
+			return nil
+		}
+
+		realm, err := b.realmName(k, bk)
+
+		if err != nil {
+			return err
+		}
+
+		records := make(Stored)
+
+		err = b.forEachRecord(bk, func(key string, v []byte) error {
+			var s Sealed
+
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("%s/%s: %w", realm, key, err)
+			}
+
+			records[key] = s
+			return nil
+		})
+
+		realms[realm] = records
+		return err
+	})
+
+	return realms, err
+}
+
+// rehideRealm moves a realm from the old cipher's names to
+// those of the current one.
+func (b *BoltDB) rehideRealm(tx *bolt.Tx, old *NameCipher, realm string, records Stored) error {
+	if err := tx.DeleteBucket([]byte(old.RealmID(realm))); err != nil {
+		return err
+	}
+
+	bk, err := b.createRealm(tx, realm)
+
+	if err != nil {
+		return err
+	}
+
+	for k, s := range records {
+		if err = b.putRecord(bk, realm, k, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readQuarantine returns the quarantined records by realm/key,
+// as they were before putQuarantined.
+func (b *BoltDB) readQuarantine(tx *bolt.Tx) (map[string][]byte, error) {
+	s := make(map[string][]byte)
+	qb := tx.Bucket([]byte(quarantineBucket))
+
+	if qb == nil {
+		return s, nil
+	}
+
+	keys, values := collect(qb)
+
+	for i, k := range keys {
+		if b.names == nil {
+			s[string(k)] = values[i]
+			continue
+		}
+
+		var q struct {
+			Name   string          `json:"name"`
+			Record json.RawMessage `json:"record"`
+		}
+
+		if err := json.Unmarshal(values[i], &q); err != nil {
+			return nil, fmt.Errorf("quarantine %s: %w", k, err)
+		}
+
+		name, err := b.names.Open(string(k), q.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s[name] = q.Record
+	}
+
+	return s, nil
+}
+
+// rehideQuarantine replaces the quarantined records with
+// those given, under the current cipher's names.
+func (b *BoltDB) rehideQuarantine(tx *bolt.Tx, records map[string][]byte) error {
+	if tx.Bucket([]byte(quarantineBucket)) == nil {
+		return nil
+	}
+
+	if err := tx.DeleteBucket([]byte(quarantineBucket)); err != nil {
+		return err
+	}
+
+	qb, err := tx.CreateBucket([]byte(quarantineBucket))
+
+	if err != nil {
+		return err
+	}
+
+	for name, v := range records {
+		if err = b.putQuarantined(qb, name, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestNameCipher(t *testing.T) {
+	var none *NameCipher
+
+	if id := none.RealmID("top"); id != "top" {
+		t.Errorf("invalid plain realm: %s", id)
+	}
+
+	if id := none.KeyID("top", "a"); id != "a" {
+		t.Errorf("invalid plain key: %s", id)
+	}
+
+	n, _ := NewNameCipher(NewTestSealer())
+
+	if n.RealmID("top") != n.RealmID("top") || n.RealmID("top") == n.RealmID("pot") {
+		t.Errorf("invalid realm IDs: %s %s", n.RealmID("top"), n.RealmID("pot"))
+	}
+
+	if n.KeyID("top", "a") == n.KeyID("pot", "a") {
+		t.Errorf("key IDs match across realms: %s", n.KeyID("top", "a"))
+	}
+
+	s, err := n.Seal("id", "secret-name")
+
+	if err != nil {
+		t.Fatal("seal", err)
+	}
+
+	if name, err := n.Open("id", s); err != nil || name != "secret-name" {
+		t.Errorf("invalid open: %s %v", name, err)
+	}
+
+	if _, err := n.Open("other", s); err == nil {
+		t.Error("opened under another ID")
+	}
+}
+
+func TestHideNames(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	fpath := path.Join(dname, "envy.db")
+	db, err := NewBoltDB(fpath)
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer func() { db.Close() }()
+
+	sd := Sealed{Data: "data", Meta: "metadata"}
+	records := Stored{"PASSWORD": sd, "USERNAME": sd, "BROKEN": sd}
+	auditKey := []byte("audit-key")
+
+	if err = db.SetRealmKey("prod-db", Sealed{Data: "key"}, records); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err = db.Quarantine("prod-db", "BROKEN"); err != nil {
+		t.Fatal("quarantine", err)
+	}
+
+	if err = db.AppendAudit(auditKey, NewAuditEntry("add", "prod-db", "PASSWORD", "test-user")); err != nil {
+		t.Fatal("audit", err)
+	}
+
+	n, _ := NewNameCipher(NewTestSealer())
+
+	if err = db.HideNames(n); err != nil {
+		t.Fatal("hide", err)
+	}
+
+	raw, err := ioutil.ReadFile(fpath)
+
+	if err != nil {
+		t.Fatal("read", err)
+	}
+
+	for _, s := range []string{"prod-db", "PASSWORD", "USERNAME", "BROKEN"} {
+		if bytes.Contains(raw, []byte(s)) {
+			t.Errorf("%s in DB file", s)
+		}
+	}
+
+	if l, err := db.ListRealms(); err != nil || !reflect.DeepEqual(l, []string{"prod-db"}) {
+		t.Errorf("invalid realms: %v %v", l, err)
+	}
+
+	delete(records, "BROKEN")
+
+	if m, err := db.GetAllKeys("prod-db"); err != nil || !reflect.DeepEqual(m, records) {
+		t.Errorf("invalid records: %v %v", m, err)
+	}
+
+	if k, err := db.GetRealmKey("prod-db"); err != nil || k.Data != "key" {
+		t.Errorf("invalid realm key: %v %v", k, err)
+	}
+
+	if err = db.AppendAudit(auditKey, NewAuditEntry("get", "prod-db", "USERNAME", "test-user")); err != nil {
+		t.Fatal("audit 2", err)
+	}
+
+	entries, head, err := db.ListAudit()
+
+	if err != nil {
+		t.Fatal("list audit", err)
+	}
+
+	if err = VerifyAudit(entries, head, auditKey); err != nil {
+		t.Errorf("invalid audit: %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Realm != "prod-db" || entries[1].Key != "USERNAME" {
+		t.Errorf("invalid audit entries: %v", entries)
+	}
+
+	// it stays hidden when reopened
+
+	db.Close()
+
+	if db, err = NewBoltDB(fpath); err != nil {
+		t.Fatal("reopen", err)
+	}
+
+	if hidden, err := db.NamesHidden(); err != nil || !hidden {
+		t.Fatalf("not hidden: %v", err)
+	}
+
+	db.UseNames(n)
+
+	if err = db.SetKey("prod-db", "HOST", sd); err != nil {
+		t.Fatal("set", err)
+	}
+
+	if l, err := db.ListKeys("prod-db"); err != nil || len(l) != 3 {
+		t.Errorf("invalid keys: %v %v", l, err)
+	}
+
+	if s, err := db.GetKey("prod-db", "HOST"); err != nil || !reflect.DeepEqual(s, sd) {
+		t.Errorf("invalid key: %v %v", s, err)
+	}
+
+	if err = db.DropKey("prod-db", "HOST"); err != nil {
+		t.Fatal("drop", err)
+	}
+
+	if _, err = db.GetKey("prod-db", "HOST"); err == nil {
+		t.Error("dropped key found")
+	}
+
+	if err = db.Purge("prod-db"); err != nil {
+		t.Fatal("purge", err)
+	}
+
+	if l, err := db.ListRealms(); err != nil || len(l) != 0 {
+		t.Errorf("invalid realms after purge: %v %v", l, err)
+	}
+}
+
+func TestRewrapNames(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	fpath := path.Join(dname, "envy.db")
+	db, err := NewBoltDB(fpath)
+
+	if err != nil {
+		t.Fatal("newdb", err)
+	}
+
+	defer func() { db.Close() }()
+
+	sd := Sealed{Data: "data", Meta: "metadata"}
+	records := Stored{"PASSWORD": sd, "BROKEN": sd}
+	auditKey := []byte("audit-key")
+
+	if err = db.SetRealmKey("prod-db", Sealed{Data: "key"}, records); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err = db.Quarantine("prod-db", "BROKEN"); err != nil {
+		t.Fatal("quarantine", err)
+	}
+
+	if err = db.Trash("prod-db", "PASSWORD", "t1", Sealed{Data: "item"}); err != nil {
+		t.Fatal("trash", err)
+	}
+
+	if err = db.SetKey("prod-db", "PASSWORD", sd); err != nil {
+		t.Fatal("set", err)
+	}
+
+	if err = db.AppendAudit(auditKey, NewAuditEntry("add", "prod-db", "PASSWORD", "test-user")); err != nil {
+		t.Fatal("audit", err)
+	}
+
+	n, _ := NewNameCipher(NewTestSealer())
+
+	if err = db.HideNames(n); err != nil {
+		t.Fatal("hide", err)
+	}
+
+	// the trash must be replaced as a whole
+
+	key, _ := NewKey()
+	n2, _ := NewNameCipher(NewTestSealer().WithKey(key))
+	auditKey2 := []byte("audit-key-2")
+	keys := Stored{"prod-db": {Data: "key2"}}
+
+	if err = db.Rewrap(Rewrap{RealmKeys: keys, Names: n2, AuditKey: auditKey2}); err == nil {
+		t.Error("rewrapped without the trash")
+	}
+
+	if m, err := db.GetAllKeys("prod-db"); err != nil || len(m) != 1 {
+		t.Errorf("invalid records after failure: %v %v", m, err)
+	}
+
+	trash := map[string]Sealed{"t1": {Data: "item2"}}
+
+	if err = db.Rewrap(Rewrap{RealmKeys: keys, Trash: trash, Names: n2, AuditKey: auditKey2}); err != nil {
+		t.Fatal("rewrap", err)
+	}
+
+	// the old cipher's names are gone, and the new one's work
+
+	db.Close()
+
+	if db, err = NewBoltDB(fpath); err != nil {
+		t.Fatal("reopen", err)
+	}
+
+	db.UseNames(n)
+
+	if _, err = db.GetKey("prod-db", "PASSWORD"); err == nil {
+		t.Error("found with the old names")
+	}
+
+	db.UseNames(n2)
+
+	if s, err := db.GetKey("prod-db", "PASSWORD"); err != nil || !reflect.DeepEqual(s, sd) {
+		t.Errorf("invalid key: %v %v", s, err)
+	}
+
+	if k, err := db.GetRealmKey("prod-db"); err != nil || k.Data != "key2" {
+		t.Errorf("invalid realm key: %v %v", k, err)
+	}
+
+	if m, err := db.ListTrash(); err != nil || !reflect.DeepEqual(m, trash) {
+		t.Errorf("invalid trash: %v %v", m, err)
+	}
+
+	err = db.db.View(func(tx *bolt.Tx) error {
+		q, err := db.readQuarantine(tx)
+
+		if err == nil && (len(q) != 1 || q["prod-db/BROKEN"] == nil) {
+			t.Errorf("invalid quarantine: %v", q)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		t.Error("quarantine", err)
+	}
+
+	entries, head, err := db.ListAudit()
+
+	if err != nil {
+		t.Fatal("list audit", err)
+	}
+
+	if err = VerifyAudit(entries, head, auditKey); err == nil {
+		t.Error("audit verified with the old key")
+	}
+
+	if err = VerifyAudit(entries, head, auditKey2); err != nil {
+		t.Errorf("invalid audit: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Realm != "prod-db" || entries[0].Key != "PASSWORD" {
+		t.Errorf("invalid audit entries: %v", entries)
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// Protection is a realm's policy: destructive operations need
+// confirmation, and revealing values needs the realm's own
+// passphrase, which is kept only as a (scrypt) verifier.
+type Protection struct {
+	KDF      kdfParams `json:"kdf"`
+	Verifier []byte    `json:"verifier"`
+}
+
+func NewProtection(passphrase []byte) (*Protection, error) {
+	p := Protection{KDF: kdfParams{Name: "scrypt", Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}}
+
+	if _, err := io.ReadFull(rand.Reader, p.KDF.Salt); err != nil {
+		return nil, err
+	}
+
+	v, err := p.KDF.derive(passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.Verifier = v
+	return &p, nil
+}
+
+// Check returns ErrWrongPassphrase unless the passphrase is right.
+func (p *Protection) Check(passphrase []byte) error {
+	v, err := p.KDF.derive(passphrase)
+
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(v, p.Verifier) {
+		return ErrWrongPassphrase
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProtection(t *testing.T) {
+	p, err := NewProtection([]byte("open sesame"))
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	if err = p.Check([]byte("open sesame")); err != nil {
+		t.Errorf("invalid check: %v", err)
+	}
+
+	if err = p.Check([]byte("open barley")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+}
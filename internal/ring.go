@@ -102,3 +102,8 @@ type mockGenerator struct{}
 func (m *mockGenerator) MakeKey() ([]byte, error) {
 	return testRing.GetSecret()
 }
+
+// NewKey returns a random key, e.g., for a realm's data.
+func NewKey() ([]byte, error) {
+	return realGenerator{}.MakeKey()
+}
@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	fileHeader    = "# envy sealed file: keys are plaintext, values are encrypted (see envy open-file)"
+	fileVersion   = "#envy:version 1"
+	fileRecipient = "#envy:recipient "
+	fileMAC       = "#envy:mac "
+	valuePrefix   = "envy:v1:"
+)
+
+var (
+	ErrBadSealedFile = errors.New("not an envy sealed file")
+	ErrFileMAC       = errors.New("sealed file has been altered")
+)
+
+// SealedFile is a dotenv-style file meant to be committed to
+// git: the keys are readable (and diffable) but each value is
+// encrypted with AES-GCM under a data key that's wrapped for
+// each recipient. The MAC covers all the keys and values, so
+// they can't be removed, renamed, or swapped unnoticed.
+type SealedFile struct {
+	Recipients []Recipient
+	Values     map[string]string // key => sealed value
+	MAC        string
+}
+
+// Recipient is a stanza along with the public key it's
+// for, so that the file can be resealed to the same users.
+type Recipient struct {
+	Public []byte
+	Stanza
+}
+
+// ReadSealedFile parses a file, but doesn't decrypt anything.
+func ReadSealedFile(r io.Reader) (*SealedFile, error) {
+	f := SealedFile{Values: make(map[string]string)}
+	s := bufio.NewScanner(r)
+	versioned := false
+
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case line == fileVersion:
+			versioned = true
+
+		case strings.HasPrefix(line, fileRecipient):
+			parts := strings.Fields(strings.TrimPrefix(line, fileRecipient))
+
+			if len(parts) != 3 {
+				return nil, ErrBadSealedFile
+			}
+
+			var (
+				r   Recipient
+				err error
+			)
+
+			if r.Public, err = ParseRecipient(parts[0]); err != nil {
+				return nil, err
+			}
+
+			if r.EPK, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+				return nil, ErrBadSealedFile
+			}
+
+			if r.Key, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+				return nil, ErrBadSealedFile
+			}
+
+			f.Recipients = append(f.Recipients, r)
+
+		case strings.HasPrefix(line, fileMAC):
+			f.MAC = strings.TrimPrefix(line, fileMAC)
+
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+
+		default:
+			i := strings.Index(line, "=")
+
+			if i < 1 || !strings.HasPrefix(line[i+1:], valuePrefix) {
+				return nil, fmt.Errorf("%q: %w", line, ErrBadSealedFile)
+			}
+
+			f.Values[line[:i]] = line[i+1:]
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if !versioned || len(f.Recipients) == 0 {
+		return nil, ErrBadSealedFile
+	}
+
+	return &f, nil
+}
+
+// Write puts out the file with keys in order, one per line.
+func (f *SealedFile) Write(w io.Writer) error {
+	b := new(bytes.Buffer)
+
+	fmt.Fprintln(b, fileHeader)
+	fmt.Fprintln(b, fileVersion)
+
+	for _, r := range f.Recipients {
+		id := Identity{Public: r.Public}
+
+		fmt.Fprintf(b, "%s%s %s %s\n", fileRecipient, id.Recipient(),
+			base64.StdEncoding.EncodeToString(r.EPK), base64.StdEncoding.EncodeToString(r.Key))
+	}
+
+	fmt.Fprintf(b, "%s%s\n\n", fileMAC, f.MAC)
+
+	for _, k := range f.keys() {
+		fmt.Fprintf(b, "%s=%s\n", k, f.Values[k])
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (f *SealedFile) keys() []string {
+	keys := make([]string, 0, len(f.Values))
+
+	for k := range f.Values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *SealedFile) sign(dataKey []byte) string {
+	km := hmac.New(sha256.New, dataKey)
+	_, _ = km.Write([]byte("envy-file-mac"))
+
+	mac := hmac.New(sha256.New, km.Sum(nil))
+
+	for _, k := range f.keys() {
+		fmt.Fprintf(mac, "%s=%s\n", k, f.Values[k])
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *SealedFile) stanzas() []Stanza {
+	result := make([]Stanza, 0, len(f.Recipients))
+
+	for _, r := range f.Recipients {
+		result = append(result, r.Stanza)
+	}
+
+	return result
+}
+
+// RecipientKeys returns the public keys the file is sealed to.
+func (f *SealedFile) RecipientKeys() [][]byte {
+	result := make([][]byte, 0, len(f.Recipients))
+
+	for _, r := range f.Recipients {
+		result = append(result, r.Public)
+	}
+
+	return result
+}
+
+// DataKey unwraps the data key, if the identity is a recipient,
+// and checks the MAC.
+func (f *SealedFile) DataKey(id *Identity) ([]byte, error) {
+	key, err := id.UnwrapKey(f.stanzas())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(f.MAC), []byte(f.sign(key))) {
+		return nil, ErrFileMAC
+	}
+
+	return key, nil
+}
+
+// Open decrypts all the values.
+func (f *SealedFile) Open(id *Identity) (map[string]string, error) {
+	key, err := f.DataKey(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(f.Values))
+
+	for k, v := range f.Values {
+		if result[k], err = openValue(key, k, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+
+	return result, nil
+}
+
+// each value is bound to its key name, so values
+// can't be swapped between keys
+
+func sealValue(key []byte, name, v string) (string, error) {
+	nonce, err := realNonce{}.GetNonce()
+
+	if err != nil {
+		return "", err
+	}
+
+	ct, err := gcmSeal(key, nonce, []byte(v), []byte(name))
+
+	if err != nil {
+		return "", err
+	}
+
+	return valuePrefix + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+func openValue(key []byte, name, v string) (string, error) {
+	ct, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, valuePrefix))
+
+	if err != nil {
+		return "", err
+	}
+
+	pt, err := gcmOpen(key, ct, []byte(name))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(pt), nil
+}
+
+// NewSealedFile seals values for the recipients. If there's a
+// previous version of the file that the identity can open, its
+// data key is kept, along with the sealed form of any value that
+// hasn't changed, so that diffs show only what really changed;
+// the recipients must then include all the previous ones (else
+// the data key must be rotated, i.e., prev must be nil).
+func NewSealedFile(values map[string]string, recipients [][]byte, prev *SealedFile, id *Identity) (*SealedFile, error) {
+	var (
+		key     []byte
+		old     map[string]string
+		stanzas = make(map[string]Recipient)
+		err     error
+	)
+
+	if prev != nil {
+		if key, err = prev.DataKey(id); err != nil {
+			return nil, err
+		}
+
+		if old, err = prev.Open(id); err != nil {
+			return nil, err
+		}
+
+		for _, r := range prev.Recipients {
+			stanzas[string(r.Public)] = r
+		}
+	} else if key, err = (realGenerator{}).MakeKey(); err != nil {
+		return nil, err
+	}
+
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	f := SealedFile{Values: make(map[string]string, len(values))}
+
+	for _, pub := range recipients {
+		r, ok := stanzas[string(pub)]
+
+		if !ok {
+			st, err := WrapKey(key, pub)
+
+			if err != nil {
+				return nil, err
+			}
+
+			r = Recipient{Public: pub, Stanza: st}
+		}
+
+		delete(stanzas, string(pub))
+		f.Recipients = append(f.Recipients, r)
+	}
+
+	if len(stanzas) > 0 {
+		return nil, fmt.Errorf("recipients removed: %w", ErrNotRecipient)
+	}
+
+	for k, v := range values {
+		if ov, ok := old[k]; ok && ov == v {
+			f.Values[k] = prev.Values[k]
+			continue
+		}
+
+		if f.Values[k], err = sealValue(key, k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	f.MAC = f.sign(key)
+	return &f, nil
+}
+
+// ParseDotenv reads KEY=VALUE lines, skipping blank lines
+// and comments; values may be double-quoted Go-style.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	result := make(map[string]string)
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: invalid pair %q", n, line)
+		}
+
+		k := strings.TrimSpace(line[:i])
+		v := strings.TrimSpace(line[i+1:])
+
+		if strings.HasPrefix(v, `"`) {
+			uq, err := strconv.Unquote(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+
+			v = uq
+		}
+
+		result[k] = v
+	}
+
+	return result, s.Err()
+}
+
+// WriteDotenv writes KEY=VALUE lines in key order, quoting
+// values that wouldn't otherwise survive ParseDotenv.
+func WriteDotenv(w io.Writer, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := values[k]
+
+		if v != strings.TrimSpace(v) || strings.ContainsAny(v, "\"'\n\r\t#\\") {
+			v = strconv.Quote(v)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
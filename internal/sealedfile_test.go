@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSealedFile(t *testing.T) { //nolint:gocyclo
+	alice, _ := NewIdentity()
+	bob, _ := NewIdentity()
+	carol, _ := NewIdentity()
+
+	values := map[string]string{"a": "XX", "b": "YY"}
+	f, err := NewSealedFile(values, [][]byte{alice.Public, bob.Public}, nil, alice)
+
+	if err != nil {
+		t.Fatal("seal", err)
+	}
+
+	b := new(bytes.Buffer)
+
+	if err = f.Write(b); err != nil {
+		t.Fatal("write", err)
+	}
+
+	raw := b.String()
+
+	if strings.Contains(raw, "=XX") || !strings.Contains(raw, "\na=envy:v1:") {
+		t.Errorf("invalid file: %s", raw)
+	}
+
+	for _, id := range []*Identity{alice, bob} {
+		f2, err := ReadSealedFile(strings.NewReader(raw))
+
+		if err != nil {
+			t.Fatal("read", err)
+		}
+
+		if m, err := f2.Open(id); err != nil || !reflect.DeepEqual(m, values) {
+			t.Errorf("invalid open: %v %v", m, err)
+		}
+	}
+
+	if _, err := f.Open(carol); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("carol can open: %v", err)
+	}
+
+	// resealing keeps unchanged values as they were
+
+	values["b"] = "ZZ"
+
+	f2, err := NewSealedFile(values, [][]byte{alice.Public, bob.Public, carol.Public}, f, bob)
+
+	if err != nil {
+		t.Fatal("reseal", err)
+	}
+
+	if f2.Values["a"] != f.Values["a"] || f2.Values["b"] == f.Values["b"] {
+		t.Errorf("invalid reseal: %v %v", f.Values, f2.Values)
+	}
+
+	if m, err := f2.Open(carol); err != nil || m["b"] != "ZZ" {
+		t.Errorf("invalid open: %v %v", m, err)
+	}
+
+	if _, err := NewSealedFile(values, [][]byte{alice.Public}, f2, alice); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("removed recipients without rotating: %v", err)
+	}
+
+	// swapping values or dropping a key is caught
+
+	f2.Values["a"], f2.Values["b"] = f2.Values["b"], f2.Values["a"]
+
+	if _, err := f2.Open(alice); !errors.Is(err, ErrFileMAC) {
+		t.Errorf("swapped values: %v", err)
+	}
+
+	f2.Values["a"], f2.Values["b"] = f2.Values["b"], f2.Values["a"]
+	delete(f2.Values, "a")
+
+	if _, err := f2.Open(alice); !errors.Is(err, ErrFileMAC) {
+		t.Errorf("dropped key: %v", err)
+	}
+
+	if _, err := ReadSealedFile(strings.NewReader("a=b\n")); !errors.Is(err, ErrBadSealedFile) {
+		t.Errorf("read dotenv: %v", err)
+	}
+}
+
+func TestDotenv(t *testing.T) {
+	in := "# comment\n\nexport A=1\nB = two words\nC=\"line\\nbreak\"\nD=\n"
+
+	m, err := ParseDotenv(strings.NewReader(in))
+
+	if err != nil {
+		t.Fatal("parse", err)
+	}
+
+	expected := map[string]string{"A": "1", "B": "two words", "C": "line\nbreak", "D": ""}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("invalid parse: %#v", m)
+	}
+
+	b := new(bytes.Buffer)
+
+	if err = WriteDotenv(b, m); err != nil {
+		t.Fatal("write", err)
+	}
+
+	if s := b.String(); s != "A=1\nB=two words\nC=\"line\\nbreak\"\nD=\n" {
+		t.Errorf("invalid write: %q", s)
+	}
+
+	if _, err := ParseDotenv(strings.NewReader("nope\n")); err == nil {
+		t.Error("parsed invalid line")
+	}
+}
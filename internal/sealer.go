@@ -1,35 +1,55 @@
 package internal
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 )
 
+var (
+	ErrShortCiphertext = errors.New("ciphertext too short")
+	ErrBadVersion      = errors.New("unknown record version")
+	ErrUnbound         = errors.New("record isn't bound to its realm and key")
+)
+
+// boundVersion is the record format in which the realm, key, and
+// metadata are all authenticated along with the value; records
+// without a version authenticate only the value's hash.
+const boundVersion = 2
+
 type Sealed struct {
 	Data string `json:"data"`
 	Meta string `json:"metadata"`
+	Name string `json:"name,omitempty"` // the key's name, if hidden in the DB
 }
 
 type Unsealed struct {
-	Data string
-	Meta metadata
+	Data string   `json:"data"`
+	Meta metadata `json:"metadata"`
 }
 
 type Stored map[string]Sealed
 type Loaded map[string]Unsealed
 
 type metadata struct {
-	Size     int    `json:"size"`      // size of the stored.Data before encryption
-	Hash     string `json:"hash"`      // hash of the stored.Data  ""     ""
-	Modified int64  `json:"timestamp"` // Unix time we make this data
+	Size     int    `json:"size"`              // size of the stored.Data before encryption
+	Hash     string `json:"hash"`              // hash of the stored.Data  ""     ""
+	Modified int64  `json:"timestamp"`         // Unix time we make this data
+	Expires  int64  `json:"expires,omitempty"` // Unix time the data expires
+	MaxAge   int64  `json:"max_age,omitempty"` // seconds after Modified it expires
+	Version  int    `json:"version,omitempty"` // record format; see SealFor
+	Type     string `json:"type,omitempty"`    // value type, if not a string
 }
 
 func (md metadata) ToString(w int) string {
@@ -37,34 +57,90 @@ func (md metadata) ToString(w int) string {
 		return "unprepared"
 	}
 
-	return fmt.Sprintf("%s  %*d  %s", time.Unix(md.Modified, 0).Format(time.RFC3339), w, md.Size, md.Hash[:7])
+	s := fmt.Sprintf("%s  %*d  %s", time.Unix(md.Modified, 0).Format(time.RFC3339), w, md.Size, md.Hash[:7])
+
+	if md.Type != "" {
+		s += "  " + md.Type
+	}
+
+	if left := DaysLeft(md.Expiry()); left != "" {
+		s += "  " + left
+	}
+
+	return s
+}
+
+// Metadata decodes the metadata, which isn't encrypted.
+func (sd Sealed) Metadata() (md metadata, err error) {
+	b, err := base64.StdEncoding.DecodeString(sd.Meta)
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &md)
+	return
 }
 
 type Sealer struct {
 	Ring
 
 	key    []byte
+	agent  *AgentClient // holds the secret key, if key is nil
 	noncer Noncer
+	bound  bool // refuse records from before SealFor
 }
 
+// NewDefaultSealer has the agent use the secret key if one is
+// running, and gets it from the keychain otherwise.
 func NewDefaultSealer() (*Sealer, error) {
-	r, err := NewKeychain()
+	kc, err := NewKeychain()
 
 	if err != nil {
 		return nil, err
 	}
 
-	k, err := r.GetSecret()
+	if p, err := AgentSocketPath(); err == nil {
+		if ac := NewAgentClient(p); ac.Running() {
+			return &Sealer{Ring: kc, agent: ac, noncer: &realNonce{}}, nil
+		}
+	}
+
+	k, err := kc.GetSecret()
 
 	if err != nil {
 		return nil, err
 	}
 
-	s := Sealer{r, k, &realNonce{}}
+	s := Sealer{Ring: kc, key: k, noncer: &realNonce{}}
 
 	return &s, nil
 }
 
+// NewDefaultSealerContext is like NewDefaultSealer, but gives
+// up when the context is done (e.g., if the keychain is waiting
+// for the user); the keychain may still be read afterwards.
+func NewDefaultSealerContext(ctx context.Context) (*Sealer, error) {
+	type result struct {
+		s   *Sealer
+		err error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		s, err := NewDefaultSealer()
+		ch <- result{s, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.s, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("reading the keychain: %w", ctx.Err())
+	}
+}
+
 func NewSealer(r Ring, n Noncer) (*Sealer, error) {
 	k, err := r.GetSecret()
 
@@ -72,7 +148,38 @@ func NewSealer(r Ring, n Noncer) (*Sealer, error) {
 		return nil, err
 	}
 
-	return &Sealer{r, k, n}, nil
+	return &Sealer{Ring: r, key: k, noncer: n}, nil
+}
+
+// WithKey returns a sealer that uses another key, e.g., a
+// realm's data key, in place of the secret key.
+func (s Sealer) WithKey(key []byte) *Sealer {
+	return &Sealer{Ring: s.Ring, key: key, noncer: s.noncer, bound: s.bound}
+}
+
+// Bound returns a sealer that refuses records sealed before
+// they were bound to their realm & key, once every record in
+// the DB has been resealed.
+func (s Sealer) Bound() *Sealer {
+	s.bound = true
+	return &s
+}
+
+// SubKey derives a key for some purpose other than sealing
+// data, e.g., signing the audit log.
+func (s Sealer) SubKey(purpose string) ([]byte, error) {
+	if s.key == nil && s.agent != nil {
+		return s.agent.Derive(purpose)
+	}
+
+	return deriveKey(s.key, purpose), nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
 }
 
 func (u *Unsealed) prep() ([]byte, []byte, error) {
@@ -90,8 +197,14 @@ func (u *Unsealed) prep() ([]byte, []byte, error) {
 
 	tag := hash.Sum(nil)
 
+	// when resealing existing data with new metadata, it
+	// keeps its original timestamp
+
+	if u.Meta.Modified == 0 {
+		u.Meta.Modified = time.Now().Unix()
+	}
+
 	u.Meta.Size = len(u.Data)
-	u.Meta.Modified = time.Now().Unix()
 	u.Meta.Hash = hex.EncodeToString(tag)
 
 	return b, tag, nil
@@ -126,18 +239,81 @@ func (s Sealer) Seal(ud Unsealed) (Sealed, error) {
 
 func (s Sealer) Unseal(sd Sealed) (Unsealed, error) {
 	var ud Unsealed
+	var err error
 
-	md, err := base64.StdEncoding.DecodeString(sd.Meta)
+	if ud.Meta, err = sd.Metadata(); err != nil {
+		return ud, err
+	}
+
+	pt, err := s.decrypt(sd.Data, ud.Meta.Hash)
 
 	if err != nil {
 		return ud, err
 	}
 
-	if err = json.Unmarshal(md, &ud.Meta); err != nil {
+	err = json.Unmarshal(pt, &ud.Data)
+	return ud, err
+}
+
+// SealFor seals a record, binding it to its realm and key and
+// to all its metadata, so that it can't be moved to another key
+// or realm, and its metadata can't be changed, unnoticed.
+func (s Sealer) SealFor(realm, key string, ud Unsealed) (Sealed, error) {
+	var sd Sealed
+
+	pt, _, err := ud.prep()
+
+	if err != nil {
+		return sd, err
+	}
+
+	ud.Meta.Version = boundVersion
+
+	md, err := json.Marshal(ud.Meta)
+
+	if err != nil {
+		return sd, err
+	}
+
+	sd.Meta = base64.StdEncoding.EncodeToString(md)
+
+	if sd.Data, err = s.encrypt(pt, boundAAD(realm, key, sd.Meta)); err != nil {
+		return sd, err
+	}
+
+	return sd, nil
+}
+
+// UnsealFor reverses SealFor, but can also read records sealed
+// (with Seal) before they were bound to their realm & key, unless
+// the sealer is Bound.
+func (s Sealer) UnsealFor(realm, key string, sd Sealed) (Unsealed, error) {
+	var ud Unsealed
+	var err error
+
+	if ud.Meta, err = sd.Metadata(); err != nil {
 		return ud, err
 	}
 
-	pt, err := s.decrypt(sd.Data, ud.Meta.Hash)
+	switch ud.Meta.Version {
+	case 0:
+		if s.bound {
+			return ud, ErrUnbound
+		}
+
+		return s.Unseal(sd)
+	case boundVersion:
+	default:
+		return ud, fmt.Errorf("version %d: %w", ud.Meta.Version, ErrBadVersion)
+	}
+
+	mixed, err := base64.StdEncoding.DecodeString(sd.Data)
+
+	if err != nil {
+		return ud, err
+	}
+
+	pt, err := s.open(mixed, boundAAD(realm, key, sd.Meta))
 
 	if err != nil {
 		return ud, err
@@ -147,40 +323,66 @@ func (s Sealer) Unseal(sd Sealed) (Unsealed, error) {
 	return ud, err
 }
 
+// boundAAD uses the metadata as stored, so that it needn't be
+// re-encoded exactly as it was; the names are length-prefixed
+// so that no two realm/key pairs give the same AAD.
+func boundAAD(realm, key, meta string) []byte {
+	return []byte(fmt.Sprintf("envy/v%d/%d:%s/%d:%s/%s", boundVersion, len(realm), realm, len(key), key, meta))
+}
+
 func (s Sealer) encrypt(pt, aad []byte) (string, error) {
-	nonce, err := s.noncer.GetNonce()
+	ct, err := s.seal(pt, aad)
 
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(s.key)
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+func (s Sealer) decrypt(data, tag string) ([]byte, error) {
+	mixed, err := base64.StdEncoding.DecodeString(data)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
+	aad, err := hex.DecodeString(tag)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	ct := aesgcm.Seal(nonce, nonce, pt, aad)
-
-	return base64.StdEncoding.EncodeToString(ct), nil
+	return s.open(mixed, aad)
 }
 
-func (s Sealer) decrypt(data, tag string) ([]byte, error) {
-	mixed, err := base64.StdEncoding.DecodeString(data)
+// seal and open use the secret key, or have the agent use it.
+func (s Sealer) seal(pt, aad []byte) ([]byte, error) {
+	if s.key == nil && s.agent != nil {
+		return s.agent.Seal(pt, aad)
+	}
+
+	nonce, err := s.noncer.GetNonce()
 
 	if err != nil {
 		return nil, err
 	}
 
-	nonce := mixed[0:12]
-	ct := mixed[12:]
-	block, err := aes.NewCipher(s.key)
+	return gcmSeal(s.key, nonce, pt, aad)
+}
+
+func (s Sealer) open(mixed, aad []byte) ([]byte, error) {
+	if s.key == nil && s.agent != nil {
+		return s.agent.Unseal(mixed, aad)
+	}
+
+	return gcmOpen(s.key, mixed, aad)
+}
+
+// gcmSeal encrypts with AES-GCM, returning the nonce
+// followed by the ciphertext.
+func gcmSeal(key, nonce, pt, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 
 	if err != nil {
 		return nil, err
@@ -192,19 +394,31 @@ func (s Sealer) decrypt(data, tag string) ([]byte, error) {
 		return nil, err
 	}
 
-	aad, err := hex.DecodeString(tag)
+	return aesgcm.Seal(nonce, nonce, pt, aad), nil
+}
+
+// gcmOpen reverses gcmSeal, expecting the nonce to
+// precede the ciphertext.
+func gcmOpen(key, mixed, aad []byte) ([]byte, error) {
+	if len(mixed) < 12 {
+		return nil, ErrShortCiphertext
+	}
+
+	nonce := mixed[0:12]
+	ct := mixed[12:]
+	block, err := aes.NewCipher(key)
 
 	if err != nil {
 		return nil, err
 	}
 
-	pt, err := aesgcm.Open(nil, nonce, ct, aad)
+	aesgcm, err := cipher.NewGCM(block)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return pt, nil
+	return aesgcm.Open(nil, nonce, ct, aad)
 }
 
 func NewTestSealer() *Sealer {
@@ -1,6 +1,9 @@
 package internal
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"testing"
 )
 
@@ -28,3 +31,77 @@ func TestSealer(t *testing.T) {
 
 	t.Log("unsealed", ud2)
 }
+
+func TestSealerBound(t *testing.T) { //nolint:gocyclo
+	s := NewTestSealer()
+
+	sd, err := s.SealFor("top", "a", Unsealed{Data: "matt"})
+
+	if err != nil {
+		t.Fatal("seal", err)
+	}
+
+	if ud, err := s.UnsealFor("top", "a", sd); err != nil || ud.Data != "matt" || ud.Meta.Version != boundVersion {
+		t.Errorf("invalid unseal: %#v %v", ud, err)
+	}
+
+	// moved to another key or realm
+
+	if _, err := s.UnsealFor("top", "b", sd); err == nil {
+		t.Error("unsealed under another key")
+	}
+
+	if _, err := s.UnsealFor("pot", "a", sd); err == nil {
+		t.Error("unsealed in another realm")
+	}
+
+	// metadata edited, or downgraded to the old format
+
+	md, _ := sd.Metadata()
+
+	for _, f := range []func(){
+		func() { md.Modified -= 3600 },
+		func() { md.Version = 0 },
+		func() { md.Version = 3 },
+	} {
+		m := md
+		f()
+
+		b, _ := json.Marshal(md)
+		edited := Sealed{Data: sd.Data, Meta: base64.StdEncoding.EncodeToString(b)}
+
+		if _, err := s.UnsealFor("top", "a", edited); err == nil {
+			t.Errorf("unsealed with edited metadata: %#v", md)
+		}
+
+		md = m
+	}
+
+	// records from before are still readable
+
+	old, err := s.Seal(Unsealed{Data: "matt"})
+
+	if err != nil {
+		t.Fatal("seal old", err)
+	}
+
+	if ud, err := s.UnsealFor("top", "a", old); err != nil || ud.Data != "matt" {
+		t.Errorf("invalid unseal of old record: %#v %v", ud, err)
+	}
+
+	// until they've all been upgraded
+
+	b := s.Bound()
+
+	if _, err := b.UnsealFor("top", "a", old); !errors.Is(err, ErrUnbound) {
+		t.Errorf("unsealed old record when bound: %v", err)
+	}
+
+	if _, err := b.WithKey(s.key).UnsealFor("top", "a", old); !errors.Is(err, ErrUnbound) {
+		t.Errorf("unsealed old record with key: %v", err)
+	}
+
+	if ud, err := b.UnsealFor("top", "a", sd); err != nil || ud.Data != "matt" {
+		t.Errorf("invalid unseal when bound: %#v %v", ud, err)
+	}
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	recipientPrefix = "envy-x25519:"
+	shareFormat     = "envy-share"
+	shareVersion    = 1
+	wrapInfo        = "envy-x25519-wrap-v1"
+)
+
+var (
+	ErrBadRecipient = errors.New("invalid public key")
+	ErrNotRecipient = errors.New("not encrypted to this user's key")
+	ErrNoRecipients = errors.New("no recipients")
+	ErrBadShare     = errors.New("not an envy shared file")
+)
+
+// Identity is a user's X25519 keypair for sharing; the private
+// key is stored in the DB sealed under the user's secret key.
+type Identity struct {
+	Private []byte `json:"private"`
+	Public  []byte `json:"public"`
+}
+
+func NewIdentity() (*Identity, error) {
+	priv := make([]byte, curve25519.ScalarSize)
+
+	if _, err := io.ReadFull(rand.Reader, priv); err != nil {
+		return nil, err
+	}
+
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{Private: priv, Public: pub}, nil
+}
+
+// Recipient is the public key in the form users pass around.
+func (id *Identity) Recipient() string {
+	return recipientPrefix + base64.RawURLEncoding.EncodeToString(id.Public)
+}
+
+// ParseRecipient decodes a public key from Recipient.
+func ParseRecipient(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.HasPrefix(s, recipientPrefix) {
+		return nil, ErrBadRecipient
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, recipientPrefix))
+
+	if err != nil || len(b) != curve25519.PointSize {
+		return nil, ErrBadRecipient
+	}
+
+	return b, nil
+}
+
+// Stanza holds a file key wrapped for one recipient, using
+// an ephemeral key, much as age does.
+type Stanza struct {
+	EPK []byte `json:"epk"`
+	Key []byte `json:"key"`
+}
+
+func wrapKey(shared, epk, pub []byte) ([]byte, error) {
+	salt := append(append([]byte{}, epk...), pub...)
+	key := make([]byte, 32)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(wrapInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// WrapKey encrypts a file key so only the recipient can read it.
+func WrapKey(fileKey, recipient []byte) (Stanza, error) {
+	var st Stanza
+
+	eph := make([]byte, curve25519.ScalarSize)
+
+	if _, err := io.ReadFull(rand.Reader, eph); err != nil {
+		return st, err
+	}
+
+	epk, err := curve25519.X25519(eph, curve25519.Basepoint)
+
+	if err != nil {
+		return st, err
+	}
+
+	shared, err := curve25519.X25519(eph, recipient)
+
+	if err != nil {
+		return st, err
+	}
+
+	wk, err := wrapKey(shared, epk, recipient)
+
+	if err != nil {
+		return st, err
+	}
+
+	nonce, err := realNonce{}.GetNonce()
+
+	if err != nil {
+		return st, err
+	}
+
+	ct, err := gcmSeal(wk, nonce, fileKey, nil)
+
+	if err != nil {
+		return st, err
+	}
+
+	return Stanza{EPK: epk, Key: ct}, nil
+}
+
+// UnwrapKey finds the stanza for this identity, if any, and
+// returns the file key.
+func (id *Identity) UnwrapKey(stanzas []Stanza) ([]byte, error) {
+	for _, st := range stanzas {
+		shared, err := curve25519.X25519(id.Private, st.EPK)
+
+		if err != nil {
+			continue
+		}
+
+		wk, err := wrapKey(shared, st.EPK, id.Public)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if key, err := gcmOpen(wk, st.Key, nil); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// WrapForAll makes a stanza for each recipient.
+func WrapForAll(fileKey []byte, recipients [][]byte) ([]Stanza, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	result := make([]Stanza, 0, len(recipients))
+
+	for _, r := range recipients {
+		st, err := WrapKey(fileKey, r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, st)
+	}
+
+	return result, nil
+}
+
+type shareFile struct {
+	Format     string   `json:"format"`
+	Version    int      `json:"version"`
+	Recipients []Stanza `json:"recipients"`
+	Data       []byte   `json:"data"` // nonce + ciphertext
+}
+
+// aad binds the recipients to the contents, so stanzas
+// can't be added or removed.
+func (f shareFile) aad() []byte {
+	b, _ := json.Marshal(f.Recipients)
+	return append([]byte(fmt.Sprintf("%s/%d/", f.Format, f.Version)), b...)
+}
+
+// WriteShared encrypts the archive so that it can only be read
+// by the recipients (given as public keys).
+func (a *Archive) WriteShared(w io.Writer, recipients [][]byte) error {
+	fileKey, err := realGenerator{}.MakeKey()
+
+	if err != nil {
+		return err
+	}
+
+	f := shareFile{Format: shareFormat, Version: shareVersion}
+
+	if f.Recipients, err = WrapForAll(fileKey, recipients); err != nil {
+		return err
+	}
+
+	pt, err := json.Marshal(a)
+
+	if err != nil {
+		return err
+	}
+
+	nonce, err := realNonce{}.GetNonce()
+
+	if err != nil {
+		return err
+	}
+
+	if f.Data, err = gcmSeal(fileKey, nonce, pt, f.aad()); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(f)
+}
+
+// ReadShared decrypts an archive from WriteShared.
+func ReadShared(r io.Reader, id *Identity) (*Archive, error) {
+	var f shareFile
+
+	if err := json.NewDecoder(r).Decode(&f); err != nil || f.Format != shareFormat {
+		return nil, ErrBadShare
+	}
+
+	if f.Version != shareVersion {
+		return nil, fmt.Errorf("version %d: %w", f.Version, ErrBadShare)
+	}
+
+	fileKey, err := id.UnwrapKey(f.Recipients)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pt, err := gcmOpen(fileKey, f.Data, f.aad())
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrBadShare)
+	}
+
+	a := NewArchive()
+
+	if err = json.Unmarshal(pt, a); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrBadShare)
+	}
+
+	return a, nil
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShareArchive(t *testing.T) { //nolint:gocyclo
+	alice, err := NewIdentity()
+
+	if err != nil {
+		t.Fatal("alice", err)
+	}
+
+	bob, _ := NewIdentity()
+	carol, _ := NewIdentity()
+
+	if k, err := ParseRecipient(alice.Recipient()); err != nil || !bytes.Equal(k, alice.Public) {
+		t.Errorf("invalid recipient: %x %v", k, err)
+	}
+
+	for _, s := range []string{"", "envy-x25519:abc", alice.Recipient()[1:]} {
+		if _, err := ParseRecipient(s); !errors.Is(err, ErrBadRecipient) {
+			t.Errorf("%q: invalid err %v", s, err)
+		}
+	}
+
+	a := NewArchive()
+	a.Realms["top"] = map[string]Unsealed{"a": {Data: "XX"}}
+
+	b := new(bytes.Buffer)
+
+	if err := a.WriteShared(b, [][]byte{alice.Public, bob.Public}); err != nil {
+		t.Fatal("write", err)
+	}
+
+	raw := b.Bytes()
+
+	for _, id := range []*Identity{alice, bob} {
+		if a2, err := ReadShared(bytes.NewReader(raw), id); err != nil {
+			t.Error("read", err)
+		} else if !reflect.DeepEqual(a, a2) {
+			t.Errorf("invalid archive: %#v", a2)
+		}
+	}
+
+	if _, err := ReadShared(bytes.NewReader(raw), carol); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("carol can read: %v", err)
+	}
+
+	if err := a.WriteShared(b, nil); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("no recipients: %v", err)
+	}
+}
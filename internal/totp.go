@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBadTOTP = errors.New("invalid TOTP seed")
+
+// TOTP generates codes from a seed as in RFC 6238, which is
+// given either as an otpauth:// URI (as in a QR code) or just
+// as the base32 secret, for the usual 6 digits every 30s.
+type TOTP struct {
+	Secret    []byte
+	Digits    int
+	Period    time.Duration
+	Algorithm string // SHA1, SHA256, or SHA512
+	Issuer    string
+	Account   string
+}
+
+// ParseTOTP reads a seed; see TOTP.
+func ParseTOTP(s string) (*TOTP, error) {
+	s = strings.TrimSpace(s)
+	t := TOTP{Digits: 6, Period: 30 * time.Second, Algorithm: "SHA1"}
+
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		b, err := decodeSecret(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.Secret = b
+		return &t, nil
+	}
+
+	u, err := url.Parse(s)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadTOTP, err)
+	}
+
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("%w: %s isn't supported", ErrBadTOTP, u.Host)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+
+	if i := strings.Index(label, ":"); i >= 0 {
+		t.Issuer, t.Account = strings.TrimSpace(label[:i]), strings.TrimSpace(label[i+1:])
+	} else {
+		t.Account = label
+	}
+
+	q := u.Query()
+
+	if iss := q.Get("issuer"); iss != "" {
+		t.Issuer = iss
+	}
+
+	if t.Secret, err = decodeSecret(q.Get("secret")); err != nil {
+		return nil, err
+	}
+
+	if d := q.Get("digits"); d != "" {
+		if t.Digits, err = strconv.Atoi(d); err != nil || t.Digits < 6 || t.Digits > 10 {
+			return nil, fmt.Errorf("%w: digits=%s", ErrBadTOTP, d)
+		}
+	}
+
+	if p := q.Get("period"); p != "" {
+		n, err := strconv.Atoi(p)
+
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%w: period=%s", ErrBadTOTP, p)
+		}
+
+		t.Period = time.Duration(n) * time.Second
+	}
+
+	if a := q.Get("algorithm"); a != "" {
+		t.Algorithm = strings.ToUpper(a)
+
+		if t.hash() == nil {
+			return nil, fmt.Errorf("%w: algorithm=%s", ErrBadTOTP, a)
+		}
+	}
+
+	return &t, nil
+}
+
+// decodeSecret takes base32 with or without padding, in
+// either case, and with any spaces (as often shown).
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	s = strings.TrimRight(s, "=")
+
+	if s == "" {
+		return nil, fmt.Errorf("%w: no secret", ErrBadTOTP)
+	}
+
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadTOTP, err)
+	}
+
+	return b, nil
+}
+
+func (t *TOTP) hash() func() hash.Hash {
+	switch t.Algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+
+	return nil
+}
+
+// Code returns the code for the given time, and how long
+// it has left before the next one.
+func (t *TOTP) Code(now time.Time) (string, time.Duration) {
+	period := int64(t.Period / time.Second)
+	counter := now.Unix() / period
+	next := time.Unix((counter+1)*period, 0)
+
+	return t.hotp(uint64(counter)), next.Sub(now)
+}
+
+// hotp is from RFC 4226, section 5.3.
+func (t *TOTP) hotp(counter uint64) string {
+	var msg [8]byte
+
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(t.hash(), t.Secret)
+	mac.Write(msg[:])
+
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+
+	mod := uint64(1)
+
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, uint64(bin)%mod)
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	// from RFC 6238, appendix B
+
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	table := []struct {
+		at   int64
+		alg  string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111111, "SHA256", "67062674"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{20000000000, "SHA256", "77737706"},
+	}
+
+	for _, tt := range table {
+		secret := base32.StdEncoding.EncodeToString([]byte(seeds[tt.alg]))
+		uri := fmt.Sprintf("otpauth://totp/Test:me@example.com?secret=%s&digits=8&algorithm=%s", secret, tt.alg)
+
+		totp, err := ParseTOTP(uri)
+
+		if err != nil {
+			t.Fatalf("parse %s: %s", uri, err)
+		}
+
+		if code, _ := totp.Code(time.Unix(tt.at, 0)); code != tt.code {
+			t.Errorf("%d %s: invalid code %s", tt.at, tt.alg, code)
+		}
+	}
+}
+
+func TestTOTPParse(t *testing.T) {
+	totp, err := ParseTOTP("otpauth://totp/ACME%20Co:jo@example.com?secret=JBSWY3DPEHPK3PXP&issuer=ACME+Co&period=60")
+
+	if err != nil {
+		t.Fatal("parse", err)
+	}
+
+	if totp.Issuer != "ACME Co" || totp.Account != "jo@example.com" || totp.Digits != 6 || totp.Period != time.Minute {
+		t.Errorf("invalid TOTP: %#v", totp)
+	}
+
+	code, left := totp.Code(time.Unix(125, 0))
+
+	if len(code) != 6 || left != 55*time.Second {
+		t.Errorf("invalid code: %s %v", code, left)
+	}
+
+	// a bare seed, as it's often shown
+
+	seed, err := ParseTOTP("jbsw y3dp ehpk 3pxp")
+
+	if err != nil {
+		t.Fatal("parse seed", err)
+	}
+
+	if string(seed.Secret) != string(totp.Secret) || seed.Period != 30*time.Second {
+		t.Errorf("invalid seed: %#v", seed)
+	}
+
+	for _, bad := range []string{
+		"",
+		"not base32!",
+		"otpauth://hotp/x?secret=JBSWY3DPEHPK3PXP&counter=1",
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=4",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&period=0",
+	} {
+		if _, err := ParseTOTP(bad); !errors.Is(err, ErrBadTOTP) {
+			t.Errorf("%q: invalid error: %v", bad, err)
+		}
+	}
+}
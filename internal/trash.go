@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// trashBucket holds dropped keys and purged realms until they're
+// restored or expire. Each item is sealed as a whole (by the caller)
+// so that names don't show, even if they're hidden elsewhere.
+const trashBucket = ".trash"
+
+// Trash drops a key (or, if key is empty, purges a realm along
+// with its data key), saving the item in the trash under an ID,
+// all at once.
+func (b *BoltDB) Trash(realm, key, id string, item Sealed) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(item)
+
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		rid := []byte(b.names.RealmID(realm))
+		bk := tx.Bucket(rid)
+
+		if bk == nil {
+			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
+		}
+
+		if key != "" {
+			if err := bk.Delete([]byte(b.names.KeyID(realm, key))); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.DeleteBucket(rid); err != nil {
+				return err
+			}
+
+			if kb := tx.Bucket([]byte(realmKeyBucket)); kb != nil {
+				if err := kb.Delete(rid); err != nil {
+					return err
+				}
+			}
+		}
+
+		tb, err := tx.CreateBucketIfNotExists([]byte(trashBucket))
+
+		if err != nil {
+			return err
+		}
+
+		return tb.Put([]byte(id), v)
+	})
+}
+
+// Clear moves all of a realm's records to the trash as one item,
+// but unlike a purge keeps the realm, and so its data key (along
+// with its policy), and puts any new records in it, all at once.
+func (b *BoltDB) Clear(realm, id string, item Sealed, records Stored) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(item)
+
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := b.realmBucket(tx, realm)
+
+		if bk == nil {
+			return fmt.Errorf("realm %s: %w", realm, ErrNotFound)
+		}
+
+		// keys can't be deleted while walking the bucket
+
+		ids := make([][]byte, 0)
+
+		err := bk.ForEach(func(k, _ []byte) error {
+			if b.names == nil || !bytes.Equal(k, []byte(realmNameKey)) {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, k := range ids {
+			if err = bk.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		for k, sd := range records {
+			if err = b.putRecord(bk, realm, k, sd); err != nil {
+				return err
+			}
+		}
+
+		tb, err := tx.CreateBucketIfNotExists([]byte(trashBucket))
+
+		if err != nil {
+			return err
+		}
+
+		return tb.Put([]byte(id), v)
+	})
+}
+
+// ListTrash returns the items in the trash by ID.
+func (b *BoltDB) ListTrash() (s map[string]Sealed, err error) {
+	s = make(map[string]Sealed)
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		tb := tx.Bucket([]byte(trashBucket))
+
+		if tb == nil {
+			return nil
+		}
+
+		return tb.ForEach(func(k, v []byte) error {
+			var sd Sealed
+
+			if err := json.Unmarshal(v, &sd); err != nil {
+				return fmt.Errorf("trash %s: %w", k, err)
+			}
+
+			s[string(k)] = sd
+			return nil
+		})
+	})
+
+	return
+}
+
+// SetTrash replaces an item in the trash, e.g., resealed.
+func (b *BoltDB) SetTrash(id string, item Sealed) error {
+	v, err := json.Marshal(item)
+
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		tb := tx.Bucket([]byte(trashBucket))
+
+		if tb == nil || tb.Get([]byte(id)) == nil {
+			return fmt.Errorf("trash %s: %w", id, ErrNotFound)
+		}
+
+		return tb.Put([]byte(id), v)
+	})
+}
+
+// Untrash puts records back in a realm, along with its data key if
+// one is given (for a realm that doesn't exist), and removes the
+// item from the trash, all at once.
+func (b *BoltDB) Untrash(id, realm string, key *Sealed, records Stored) error {
+	if err := checkRealm(realm); err != nil {
+		return err
+	}
+
+	var kv []byte
+
+	if key != nil {
+		var err error
+
+		if kv, err = json.Marshal(key); err != nil {
+			return err
+		}
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		tb := tx.Bucket([]byte(trashBucket))
+
+		if tb == nil || tb.Get([]byte(id)) == nil {
+			return fmt.Errorf("trash %s: %w", id, ErrNotFound)
+		}
+
+		if kv != nil {
+			kb, err := tx.CreateBucketIfNotExists([]byte(realmKeyBucket))
+
+			if err != nil {
+				return err
+			}
+
+			if err = kb.Put([]byte(b.names.RealmID(realm)), kv); err != nil {
+				return err
+			}
+		}
+
+		bk, err := b.createRealm(tx, realm)
+
+		if err != nil {
+			return err
+		}
+
+		for k, sd := range records {
+			if err = b.putRecord(bk, realm, k, sd); err != nil {
+				return err
+			}
+		}
+
+		return tb.Delete([]byte(id))
+	})
+}
+
+// DeleteTrash removes items from the trash for good.
+func (b *BoltDB) DeleteTrash(ids ...string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		tb := tx.Bucket([]byte(trashBucket))
+
+		if tb == nil {
+			return nil
+		}
+
+		for _, id := range ids {
+			if err := tb.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBoltDBTrash(t *testing.T) { //nolint:gocyclo
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "envy.db"))
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer db.Close()
+
+	rk := Sealed{Data: "key", Meta: "meta"}
+	a := Sealed{Data: "a", Meta: "meta"}
+	b := Sealed{Data: "b", Meta: "meta"}
+
+	if err = db.SetRealmKey("top", rk, Stored{"a": a, "b": b}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err = db.Trash("top", "a", "1", Sealed{Data: "item-a"}); err != nil {
+		t.Fatal("trash key", err)
+	}
+
+	if _, err = db.GetKey("top", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("key not dropped: %v", err)
+	}
+
+	if err = db.Trash("top", "", "2", Sealed{Data: "item-top"}); err != nil {
+		t.Fatal("trash realm", err)
+	}
+
+	if _, err = db.ListKeys("top"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("realm not purged: %v", err)
+	}
+
+	if _, err = db.GetRealmKey("top"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("realm key not purged: %v", err)
+	}
+
+	if err = db.Trash("none", "", "3", Sealed{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("trashed missing realm: %v", err)
+	}
+
+	m, err := db.ListTrash()
+
+	if err != nil || len(m) != 2 || m["1"].Data != "item-a" || m["2"].Data != "item-top" {
+		t.Fatalf("invalid trash: %#v %v", m, err)
+	}
+
+	if err = db.Untrash("2", "top", &rk, Stored{"b": b}); err != nil {
+		t.Fatal("untrash", err)
+	}
+
+	if sd, err := db.GetRealmKey("top"); err != nil || sd != rk {
+		t.Errorf("invalid realm key: %#v %v", sd, err)
+	}
+
+	if sd, err := db.GetKey("top", "b"); err != nil || sd != b {
+		t.Errorf("invalid key: %#v %v", sd, err)
+	}
+
+	if err = db.Untrash("2", "top", nil, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("untrashed twice: %v", err)
+	}
+
+	if err = db.DeleteTrash("1"); err != nil {
+		t.Fatal("delete", err)
+	}
+
+	if m, err = db.ListTrash(); err != nil || len(m) != 0 {
+		t.Errorf("trash not empty: %#v %v", m, err)
+	}
+}
+
+func TestBoltDBClear(t *testing.T) {
+	dname, err := ioutil.TempDir("", "envy")
+
+	if err != nil {
+		t.Fatal("tempdir", err)
+	}
+
+	defer os.RemoveAll(dname)
+
+	db, err := NewBoltDB(path.Join(dname, "envy.db"))
+
+	if err != nil {
+		t.Fatal("new", err)
+	}
+
+	defer db.Close()
+
+	rk := Sealed{Data: "key", Meta: "meta"}
+	a := Sealed{Data: "a", Meta: "meta"}
+
+	if err = db.SetRealmKey("top", rk, Stored{"a": a, "b": a}); err != nil {
+		t.Fatal("setup", err)
+	}
+
+	if err = db.Clear("top", "1", Sealed{Data: "item-top"}, nil); err != nil {
+		t.Fatal("clear", err)
+	}
+
+	if keys, err := db.ListKeys("top"); err != nil || len(keys) != 0 {
+		t.Errorf("realm not cleared: %v %v", keys, err)
+	}
+
+	if sd, err := db.GetRealmKey("top"); err != nil || sd != rk {
+		t.Errorf("realm key not kept: %#v %v", sd, err)
+	}
+
+	if m, err := db.ListTrash(); err != nil || m["1"].Data != "item-top" {
+		t.Errorf("invalid trash: %#v %v", m, err)
+	}
+
+	if err = db.Clear("none", "2", Sealed{}, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cleared missing realm: %v", err)
+	}
+}
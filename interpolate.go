@@ -0,0 +1,164 @@
+package envy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Template values may refer to other values, as ${KEY} in the same
+// realm or ${realm/KEY} in another; they're resolved as they're
+// fetched (see internal.Expand), and become strings. Other values
+// are never expanded, even if they contain "${".
+
+var (
+	ErrCycle      = errors.New("reference cycle")
+	ErrNotAllowed = errors.New("realm not allowed")
+)
+
+// FetchOptions control how values are fetched.
+type FetchOptions struct {
+	Unresolved bool                    // leave references as they are
+	Allow      func(realm string) bool // realms references may read (default: all)
+}
+
+// resolver expands references, reading each realm at most once
+// and each value only once, and keeping track of other values
+// read along the way (for the audit log).
+type resolver struct {
+	e      *Envy
+	ctx    context.Context
+	opts   FetchOptions
+	loaded map[string]internal.Loaded
+	done   map[string]string
+	path   []string
+	reads  map[string][]string
+}
+
+func (e *Envy) newResolver(ctx context.Context, opts FetchOptions) *resolver {
+	return &resolver{
+		e:      e,
+		ctx:    ctx,
+		opts:   opts,
+		loaded: make(map[string]internal.Loaded),
+		done:   make(map[string]string),
+		reads:  make(map[string][]string),
+	}
+}
+
+func (r *resolver) load(realm string) (internal.Loaded, error) {
+	if m, ok := r.loaded[realm]; ok {
+		return m, nil
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if r.opts.Allow != nil && !r.opts.Allow(realm) {
+		return nil, fmt.Errorf("reference to %s: %w", realm, ErrNotAllowed)
+	}
+
+	if err := r.e.checkReveal(realm); err != nil {
+		return nil, err
+	}
+
+	m, err := r.e.fetchRaw(realm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.loaded[realm] = m
+	return m, nil
+}
+
+// lookup resolves a value referred to by another.
+func (r *resolver) lookup(realm, key string) (string, error) {
+	v, err := r.resolve(realm, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	r.reads[realm] = append(r.reads[realm], key)
+	return v, nil
+}
+
+// resolve returns a value with its references expanded.
+func (r *resolver) resolve(realm, key string) (string, error) {
+	id := realm + "/" + key
+
+	if v, ok := r.done[id]; ok {
+		return v, nil
+	}
+
+	for i, p := range r.path {
+		if p == id {
+			return "", fmt.Errorf("%s -> %s: %w", strings.Join(r.path[i:], " -> "), id, ErrCycle)
+		}
+	}
+
+	m, err := r.load(realm)
+
+	if err != nil {
+		return "", err
+	}
+
+	ud, ok := m[key]
+
+	if !ok {
+		return "", fmt.Errorf("reference to %s: %w", id, internal.ErrNotFound)
+	}
+
+	v := ud.Data
+
+	if ud.Meta.Type == TypeTemplate {
+		r.path = append(r.path, id)
+		v, err = internal.Expand(v, realm, r.lookup)
+		r.path = r.path[:len(r.path)-1]
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	r.done[id] = v
+	return v, nil
+}
+
+// audit records values read through references, other than
+// those in a realm that's been fetched (and so audited) whole.
+func (r *resolver) audit(fetched string) error {
+	realms := make([]string, 0, len(r.reads))
+
+	for realm := range r.reads {
+		if realm != fetched {
+			realms = append(realms, realm)
+		}
+	}
+
+	sort.Strings(realms)
+
+	for _, realm := range realms {
+		seen := make(map[string]bool)
+		keys := make([]string, 0, len(r.reads[realm]))
+
+		for _, k := range r.reads[realm] {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+
+		if err := r.e.audit("get", realm, keys...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
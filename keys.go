@@ -0,0 +1,407 @@
+package envy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Each realm's records are sealed under its own data key, which
+// is stored sealed under the secret key from the keychain (i.e.,
+// envelope encryption). A realm's key can be rotated without
+// touching other realms, and changing the secret key would only
+// mean resealing the data keys.
+
+// realmKeys is the "realm" to which data keys are bound when
+// they're sealed; it can't be the name of a real realm.
+const realmKeys = ".keys"
+
+// realmRecord is what's sealed in a realm's key record: its data
+// key and, if the realm is protected, its policy. Realm keys from
+// before there were policies are just the key, base64-encoded.
+type realmRecord struct {
+	Key    []byte               `json:"key"`
+	Policy *internal.Protection `json:"policy,omitempty"`
+}
+
+// realmKey returns the realm's key record, or nil if it
+// doesn't have one yet.
+func (e *Envy) realmKey(realm string) (*realmRecord, error) {
+	sd, err := e.db.GetRealmKey(realm)
+
+	if errors.Is(err, internal.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return e.openRealmKey(realm, sd)
+}
+
+// openRealmKey unseals a realm's key record.
+func (e *Envy) openRealmKey(realm string, sd internal.Sealed) (*realmRecord, error) {
+	ud, err := e.sealer.UnsealFor(realmKeys, realm, sd)
+
+	if err != nil {
+		return nil, fmt.Errorf("unsealing key for %s: %w", realm, err)
+	}
+
+	var rr realmRecord
+
+	if strings.HasPrefix(ud.Data, "{") {
+		err = json.Unmarshal([]byte(ud.Data), &rr)
+	} else {
+		rr.Key, err = base64.StdEncoding.DecodeString(ud.Data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("decoding key for %s: %w", realm, err)
+	}
+
+	return &rr, nil
+}
+
+// realmSealer returns a sealer for the realm's data key. If the
+// realm doesn't have one yet, it's given one if create is true,
+// and its existing records (if any) are resealed under it; if
+// not, records are read with the secret key, as they were sealed
+// before realms had their own keys.
+func (e *Envy) realmSealer(realm string, create bool) (*internal.Sealer, error) {
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rr != nil {
+		return e.sealer.WithKey(rr.Key), nil
+	}
+
+	if !create {
+		return e.sealer, nil
+	}
+
+	return e.newRealmKey(realm, e.sealer, nil)
+}
+
+// sealRealmKey seals a realm's key record for the DB.
+func sealRealmKey(s *internal.Sealer, realm string, rr realmRecord) (internal.Sealed, error) {
+	b, err := json.Marshal(rr)
+
+	if err != nil {
+		return internal.Sealed{}, err
+	}
+
+	return s.SealFor(realmKeys, realm, internal.Unsealed{Data: string(b)})
+}
+
+// newRealmKey makes a data key for the realm and reseals any
+// records from the old sealer under it, storing both at once;
+// the realm's policy (if any) carries over.
+func (e *Envy) newRealmKey(realm string, old *internal.Sealer, policy *internal.Protection) (*internal.Sealer, error) {
+	stored, err := e.db.GetAllKeys(realm)
+
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return nil, err
+	}
+
+	key, err := internal.NewKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := e.sealer.WithKey(key)
+	resealed := make(internal.Stored, len(stored))
+
+	for k, sd := range stored {
+		ud, err := old.UnsealFor(realm, k, sd)
+
+		if err != nil {
+			return nil, fmt.Errorf("unsealing %s/%s: %w", realm, k, err)
+		}
+
+		// sealing keeps the original timestamp & expiry
+
+		if resealed[k], err = s.SealFor(realm, k, ud); err != nil {
+			return nil, fmt.Errorf("sealing %s/%s: %w", realm, k, err)
+		}
+	}
+
+	wrapped, err := sealRealmKey(e.sealer, realm, realmRecord{Key: key, Policy: policy})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = e.db.SetRealmKey(realm, wrapped, resealed); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// RotateRealmKey gives the realm a new data key, resealing all
+// its records (in the current format, bound to their realm and
+// key); other realms aren't affected.
+func (e *Envy) RotateRealmKey(realm string) error {
+	if _, err := e.db.ListKeys(realm); err != nil {
+		return fmt.Errorf("fetching %s: %w", realm, err)
+	}
+
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return err
+	}
+
+	old, policy := e.sealer, (*internal.Protection)(nil)
+
+	if rr != nil {
+		old, policy = e.sealer.WithKey(rr.Key), rr.Policy
+	}
+
+	if _, err = e.newRealmKey(realm, old, policy); err != nil {
+		return err
+	}
+
+	return e.audit("rotate", realm)
+}
+
+// RewrapRealmKeys moves the store to a new secret key, all at
+// once: every realm's data key (and policy) is resealed under it,
+// without touching the realms' records, as are the user's identity
+// and the items in the trash, and hidden names and the audit log
+// are hidden and signed again with keys derived from it. Realms
+// from before there were data keys are given one first. The audit
+// log must verify, as it's signed again as it is. This Envy uses
+// the new key from then on, but storing it (e.g., in the keychain)
+// is up to the caller.
+func (e *Envy) RewrapRealmKeys(secret []byte) error {
+	if err := e.VerifyAudit(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	next := e.sealer.WithKey(secret)
+	realms, err := e.db.ListRealms()
+
+	if err != nil {
+		return err
+	}
+
+	wrapped := make(internal.Stored, len(realms))
+
+	for _, r := range realms {
+		if _, err = e.realmSealer(r, true); err != nil {
+			return err
+		}
+
+		rr, err := e.realmKey(r)
+
+		if err != nil {
+			return err
+		}
+
+		if wrapped[r], err = sealRealmKey(next, r, *rr); err != nil {
+			return fmt.Errorf("sealing key for %s: %w", r, err)
+		}
+	}
+
+	identity, err := e.resealIdentity(next)
+
+	if err != nil {
+		return err
+	}
+
+	trash, err := e.resealTrash(next)
+
+	if err != nil {
+		return err
+	}
+
+	names, err := internal.NewNameCipher(next)
+
+	if err != nil {
+		return err
+	}
+
+	auditKey, err := next.SubKey("audit")
+
+	if err != nil {
+		return err
+	}
+
+	rw := internal.Rewrap{
+		RealmKeys: wrapped,
+		Identity:  identity,
+		Trash:     trash,
+		Names:     names,
+		AuditKey:  auditKey,
+	}
+
+	if err = e.db.Rewrap(rw); err != nil {
+		return err
+	}
+
+	e.sealer = next
+	return e.audit("rewrap", "")
+}
+
+// Upgrade reseals everything in the DB in the current format:
+// every realm under a new data key (as RotateRealmKey does), the
+// user's identity, and the items in the trash. It then marks the
+// DB, so that records in the old format, which aren't bound to
+// their realm & key, are refused from then on rather than read.
+func (e *Envy) Upgrade() error {
+	realms, err := e.db.ListRealms()
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range realms {
+		if err = e.RotateRealmKey(r); err != nil {
+			return err
+		}
+	}
+
+	if err = e.upgradeIdentity(); err != nil {
+		return err
+	}
+
+	if err = e.upgradeTrash(); err != nil {
+		return err
+	}
+
+	if err = e.db.SetBound(); err != nil {
+		return err
+	}
+
+	e.sealer = e.sealer.Bound()
+	return e.audit("upgrade", "")
+}
+
+func (e *Envy) upgradeIdentity() error {
+	sd, err := e.resealIdentity(e.sealer)
+
+	if err != nil || sd == nil {
+		return err
+	}
+
+	return e.db.SetIdentity(*sd)
+}
+
+func (e *Envy) upgradeTrash() error {
+	m, err := e.resealTrash(e.sealer)
+
+	if err != nil {
+		return err
+	}
+
+	for id, sd := range m {
+		if err = e.db.SetTrash(id, sd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resealIdentity returns the user's identity sealed with the
+// sealer, or nil if there's none.
+func (e *Envy) resealIdentity(s *internal.Sealer) (*internal.Sealed, error) {
+	sd, err := e.db.GetIdentity()
+
+	if errors.Is(err, internal.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ud, err := e.sealer.UnsealFor(identityLabel, "x25519", sd)
+
+	if err != nil {
+		return nil, fmt.Errorf("unsealing identity: %w", err)
+	}
+
+	if sd, err = s.SealFor(identityLabel, "x25519", ud); err != nil {
+		return nil, err
+	}
+
+	return &sd, nil
+}
+
+// resealTrash returns each item in the trash sealed with the
+// sealer, along with the records in it (and the data key that
+// goes with them), as they were sealed when they were dropped.
+func (e *Envy) resealTrash(next *internal.Sealer) (map[string]internal.Sealed, error) {
+	m, err := e.db.ListTrash()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for id, sd := range m {
+		ud, err := e.sealer.UnsealFor(trashLabel, id, sd)
+
+		if err != nil {
+			return nil, fmt.Errorf("unsealing trash %s: %w", id, err)
+		}
+
+		var item trashed
+
+		if err = json.Unmarshal([]byte(ud.Data), &item); err != nil {
+			return nil, fmt.Errorf("decoding trash %s: %w", id, err)
+		}
+
+		from, to := e.sealer, next
+
+		if item.RealmKey != nil {
+			rr, err := e.openRealmKey(item.Realm, *item.RealmKey)
+
+			if err != nil {
+				return nil, err
+			}
+
+			rk, err := sealRealmKey(next, item.Realm, *rr)
+
+			if err != nil {
+				return nil, err
+			}
+
+			from, to, item.RealmKey = e.sealer.WithKey(rr.Key), next.WithKey(rr.Key), &rk
+		}
+
+		for k, rsd := range item.Records {
+			rud, err := from.UnsealFor(item.Realm, k, rsd)
+
+			if err != nil {
+				return nil, fmt.Errorf("unsealing trash %s/%s: %w", item.Realm, k, err)
+			}
+
+			if item.Records[k], err = to.SealFor(item.Realm, k, rud); err != nil {
+				return nil, err
+			}
+		}
+
+		b, err := json.Marshal(item)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// sealing keeps the item's expiry
+
+		ud.Data = string(b)
+
+		if m[id], err = next.SealFor(trashLabel, id, ud); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
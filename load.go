@@ -0,0 +1,85 @@
+package envy
+
+import (
+	"fmt"
+	"os"
+)
+
+// RealmEnv names the realm(s) the autoload package
+// loads, separated by commas.
+const RealmEnv = "ENVY_REALM"
+
+// Load sets the values of the realms as variables in this
+// process's environment, using the standard store. A variable
+// that's already set is left alone, as is a key that's in more
+// than one realm after the first; see Overload.
+func Load(realms ...string) error {
+	return load(false, realms)
+}
+
+// Overload is like Load, but the values replace variables
+// already set, and a realm's keys replace any earlier realm's.
+func Overload(realms ...string) error {
+	return load(true, realms)
+}
+
+func load(override bool, realms []string) error {
+	e, err := New()
+
+	if err != nil {
+		return err
+	}
+
+	defer e.Close()
+
+	if override {
+		return e.Overload(realms...)
+	}
+
+	return e.Load(realms...)
+}
+
+// Load is like the package's Load, from this store.
+func (e *Envy) Load(realms ...string) error {
+	return e.setenv(false, realms)
+}
+
+// Overload is like the package's Overload, from this store.
+func (e *Envy) Overload(realms ...string) error {
+	return e.setenv(true, realms)
+}
+
+// setenv fetches all the realms before setting anything,
+// so that a failure doesn't leave the environment half-loaded.
+// (Binary values are base64, as from Fetch.)
+func (e *Envy) setenv(override bool, realms []string) error {
+	vars := make(map[string]string)
+
+	for _, realm := range realms {
+		m, err := e.Fetch(realm)
+
+		if err != nil {
+			return err
+		}
+
+		for k, v := range m {
+			if _, ok := vars[k]; ok && !override {
+				continue
+			}
+
+			vars[k] = v
+		}
+	}
+
+	for k, v := range vars {
+		if _, ok := os.LookupEnv(k); ok && !override {
+			continue
+		}
+
+		if err := os.Setenv(k, v); err != nil {
+			return fmt.Errorf("setting %s: %w", k, err)
+		}
+	}
+
+	return nil
+}
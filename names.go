@@ -0,0 +1,23 @@
+package envy
+
+import (
+	"github.com/matt4biz/envy/internal"
+)
+
+// HideNames switches the DB, once and for all, to a mode where
+// realm and key names are stored encrypted, and buckets and
+// records are found by keyed hashes of their names, so that a
+// copy of the DB doesn't give away what the secrets are for.
+func (e *Envy) HideNames() error {
+	n, err := internal.NewNameCipher(e.sealer)
+
+	if err != nil {
+		return err
+	}
+
+	if err = e.db.HideNames(n); err != nil {
+		return err
+	}
+
+	return e.audit("hide", "")
+}
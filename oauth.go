@@ -0,0 +1,211 @@
+package envy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A realm with an OAuth2 token endpoint and refresh token is
+// "refreshable": its access token is kept along with the other
+// values, and replaced through the endpoint when it expires.
+const (
+	OAuthTokenURL     = "OAUTH_TOKEN_URL"
+	OAuthClientID     = "OAUTH_CLIENT_ID"
+	OAuthClientSecret = "OAUTH_CLIENT_SECRET" // optional
+	OAuthScopes       = "OAUTH_SCOPES"        // optional, separated by spaces
+	OAuthRefreshToken = "OAUTH_REFRESH_TOKEN"
+	OAuthAccessToken  = "OAUTH_ACCESS_TOKEN" // written back
+	OAuthExpiry       = "OAUTH_EXPIRY"       // written back, RFC 3339
+)
+
+// tokenLeeway is how long before it expires that an access
+// token is replaced, so that it's still good once it's used.
+const tokenLeeway = 30 * time.Second
+
+// defaultTokenLifetime is how long an access token is kept if
+// the endpoint doesn't say when it expires.
+const defaultTokenLifetime = 5 * time.Minute
+
+var (
+	ErrNotRefreshable = errors.New("no OAuth token endpoint or refresh token")
+	ErrTokenRefresh   = errors.New("token refresh failed")
+)
+
+var tokenClient = &http.Client{Timeout: 30 * time.Second}
+
+// IsOAuthKey reports whether a key is one of those written
+// back when an access token is refreshed.
+func IsOAuthKey(key string) bool {
+	return key == OAuthAccessToken || key == OAuthExpiry || key == OAuthRefreshToken
+}
+
+// Refreshable reports whether the realm has what's needed
+// to refresh an access token.
+func (e *Envy) Refreshable(realm string) (bool, error) {
+	keys, err := e.db.ListKeys(realm)
+
+	if err != nil {
+		return false, fmt.Errorf("listing %s: %w", realm, err)
+	}
+
+	var url, token bool
+
+	for _, k := range keys {
+		url = url || k == OAuthTokenURL
+		token = token || k == OAuthRefreshToken
+	}
+
+	return url && token, nil
+}
+
+// AccessToken returns the realm's access token, getting a new
+// one from the token endpoint (with the refresh token) if it's
+// missing or about to expire; the new access token, its expiry,
+// and any new refresh token are written back to the realm.
+func (e *Envy) AccessToken(ctx context.Context, realm string) (string, error) {
+	vals, err := e.FetchWithContext(ctx, realm, FetchOptions{})
+
+	if err != nil {
+		return "", err
+	}
+
+	if vals[OAuthTokenURL].Data == "" || vals[OAuthRefreshToken].Data == "" {
+		return "", fmt.Errorf("%s: %w", realm, ErrNotRefreshable)
+	}
+
+	if t := vals[OAuthAccessToken].Data; t != "" && !tokenExpired(vals[OAuthExpiry].Data) {
+		return t, nil
+	}
+
+	tok, err := refreshToken(ctx, vals)
+
+	if err != nil {
+		return "", fmt.Errorf("refreshing %s: %w", realm, err)
+	}
+
+	if err = e.saveToken(realm, tok, vals[OAuthRefreshToken].Data); err != nil {
+		return "", err
+	}
+
+	return tok.AccessToken, nil
+}
+
+// tokenExpired reports whether a token with the given expiry
+// should be replaced; one without an expiry always is.
+func tokenExpired(expiry string) bool {
+	t, err := time.Parse(time.RFC3339, expiry)
+
+	return err != nil || time.Now().Add(tokenLeeway).After(t)
+}
+
+// tokenResponse is from RFC 6749, sections 5.1 and 5.2.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+func refreshToken(ctx context.Context, vals map[string]Value) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {vals[OAuthRefreshToken].Data},
+	}
+
+	if s := vals[OAuthScopes].Data; s != "" {
+		form.Set("scope", s)
+	}
+
+	id, secret := vals[OAuthClientID].Data, vals[OAuthClientSecret].Data
+
+	// a public client just identifies itself
+
+	if secret == "" && id != "" {
+		form.Set("client_id", id)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vals[OAuthTokenURL].Data, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if secret != "" {
+		req.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+	}
+
+	resp, err := tokenClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tok tokenResponse
+
+	if err = json.Unmarshal(b, &tok); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%w: invalid response: %s", ErrTokenRefresh, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		msg := tok.Error
+
+		if tok.Description != "" {
+			msg += ": " + tok.Description
+		}
+
+		if msg == "" {
+			msg = resp.Status
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrTokenRefresh, msg)
+	}
+
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%w: no access token", ErrTokenRefresh)
+	}
+
+	return &tok, nil
+}
+
+// saveToken writes back a new access token and its expiry, and
+// the refresh token if the endpoint has replaced it, all at once,
+// as the old refresh token may no longer work.
+func (e *Envy) saveToken(realm string, tok *tokenResponse, refresh string) error {
+	lifetime := defaultTokenLifetime
+
+	if tok.ExpiresIn > 0 {
+		lifetime = time.Duration(tok.ExpiresIn) * time.Second
+	}
+
+	vals := map[string]Value{
+		OAuthAccessToken: {Data: tok.AccessToken},
+		OAuthExpiry:      {Data: time.Now().Add(lifetime).UTC().Format(time.RFC3339)},
+	}
+
+	if tok.RefreshToken != "" && tok.RefreshToken != refresh {
+		vals[OAuthRefreshToken] = Value{Data: tok.RefreshToken}
+	}
+
+	return e.AddValues(realm, vals)
+}
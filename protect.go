@@ -0,0 +1,144 @@
+package envy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// A protected realm has its own passphrase, which must be given
+// to Unlock before any of its values are revealed; its policy is
+// kept with its data key, so it's sealed and bound to the realm.
+// (Destructive operations on it are left to the caller to confirm.)
+
+var ErrProtected = errors.New("realm is protected; unlock it first")
+
+// Protect sets a passphrase for the realm, which must exist; if
+// it's already protected, it must be unlocked to change it.
+func (e *Envy) Protect(realm string, passphrase []byte) error {
+	if _, err := e.db.ListKeys(realm); err != nil {
+		return fmt.Errorf("fetching %s: %w", realm, err)
+	}
+
+	if err := e.checkReveal(realm); err != nil {
+		return err
+	}
+
+	if _, err := e.realmSealer(realm, true); err != nil {
+		return err
+	}
+
+	p, err := internal.NewProtection(passphrase)
+
+	if err != nil {
+		return err
+	}
+
+	if err = e.setPolicy(realm, p); err != nil {
+		return err
+	}
+
+	e.unlocked[realm] = true
+	return e.audit("protect", realm)
+}
+
+// Unprotect removes the realm's passphrase; it must be unlocked.
+func (e *Envy) Unprotect(realm string) error {
+	if err := e.checkReveal(realm); err != nil {
+		return err
+	}
+
+	if ok, err := e.Protected(realm); err != nil || !ok {
+		return err
+	}
+
+	if err := e.setPolicy(realm, nil); err != nil {
+		return err
+	}
+
+	return e.audit("unprotect", realm)
+}
+
+// Protected reports whether the realm has a passphrase.
+func (e *Envy) Protected(realm string) (bool, error) {
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return false, err
+	}
+
+	return rr != nil && rr.Policy != nil, nil
+}
+
+// Unlock checks the realm's passphrase before its values can be
+// revealed (for as long as this Envy is open); a failed attempt
+// is recorded in the audit log. Unprotected realms need nothing.
+func (e *Envy) Unlock(realm string, passphrase []byte) error {
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return err
+	}
+
+	if rr == nil || rr.Policy == nil {
+		return nil
+	}
+
+	if err = rr.Policy.Check(passphrase); err != nil {
+		if errors.Is(err, internal.ErrWrongPassphrase) {
+			if aerr := e.audit("deny", realm); aerr != nil {
+				return aerr
+			}
+		}
+
+		return fmt.Errorf("unlocking %s: %w", realm, err)
+	}
+
+	e.unlocked[realm] = true
+	return e.audit("unlock", realm)
+}
+
+// checkReveal returns ErrProtected unless the realm's values
+// may be revealed.
+func (e *Envy) checkReveal(realm string) error {
+	if e.unlocked[realm] {
+		return nil
+	}
+
+	ok, err := e.Protected(realm)
+
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return fmt.Errorf("%s: %w", realm, ErrProtected)
+	}
+
+	return nil
+}
+
+// setPolicy stores the realm's policy with its data key, which
+// the realm must already have.
+func (e *Envy) setPolicy(realm string, p *internal.Protection) error {
+	rr, err := e.realmKey(realm)
+
+	if err != nil {
+		return err
+	}
+
+	if rr == nil {
+		return fmt.Errorf("key for %s: %w", realm, internal.ErrNotFound)
+	}
+
+	rr.Policy = p
+
+	sd, err := sealRealmKey(e.sealer, realm, *rr)
+
+	if err != nil {
+		return err
+	}
+
+	return e.db.SetRealmKey(realm, sd, nil)
+}
@@ -0,0 +1,202 @@
+package envy
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// SealFileOptions control how a sealed file is (re)written.
+type SealFileOptions struct {
+	Recipients []string  // public keys besides this user's
+	Prev       io.Reader // the file's current contents, if any
+	Rotate     bool      // use a new data key, dropping Prev's recipients
+}
+
+// SealFile writes values in a form that may be committed to git:
+// the keys are readable but each value is encrypted, for this user
+// and the recipients. Unless rotating, the previous version's data
+// key, recipients, and sealed values (where unchanged) are kept, so
+// that a diff shows only the keys that really changed.
+func (e *Envy) SealFile(w io.Writer, values map[string]string, opts SealFileOptions) error {
+	id, err := e.identity()
+
+	if err != nil {
+		return err
+	}
+
+	var prev *internal.SealedFile
+
+	keys := [][]byte{id.Public}
+
+	if opts.Prev != nil && !opts.Rotate {
+		if prev, err = internal.ReadSealedFile(opts.Prev); err != nil {
+			return err
+		}
+
+		keys = append(keys, prev.RecipientKeys()...)
+	}
+
+	for _, r := range opts.Recipients {
+		k, err := internal.ParseRecipient(r)
+
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, k)
+	}
+
+	f, err := internal.NewSealedFile(values, uniqueKeys(keys), prev, id)
+
+	if err != nil {
+		return err
+	}
+
+	return f.Write(w)
+}
+
+func uniqueKeys(keys [][]byte) [][]byte {
+	result := make([][]byte, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+
+	for _, k := range keys {
+		if !seen[string(k)] {
+			seen[string(k)] = true
+			result = append(result, k)
+		}
+	}
+
+	return result
+}
+
+// OpenFile decrypts a sealed file, if this user is a recipient.
+func (e *Envy) OpenFile(r io.Reader) (map[string]string, error) {
+	id, err := e.identity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := internal.ReadSealedFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Open(id)
+}
+
+// SealedKeys lists the keys in a sealed file without decrypting
+// it, e.g., to show a diff to a user who isn't a recipient.
+func SealedKeys(r io.Reader) ([]string, error) {
+	f, err := internal.ReadSealedFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(f.Values))
+
+	for k := range f.Values {
+		result = append(result, k)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// MergeFiles does a three-way merge of sealed files by key,
+// as a git merge driver would: a key changed on only one side
+// takes that change, while a key changed differently on both
+// keeps our value and is returned as a conflict. The result is
+// resealed from ours, to the recipients of both sides.
+func (e *Envy) MergeFiles(w io.Writer, base, ours, theirs []byte) ([]string, error) {
+	id, err := e.identity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*internal.SealedFile, 3)
+	values := make([]map[string]string, 3)
+
+	for i, b := range [][]byte{base, ours, theirs} {
+		// the base is empty if both sides added the file
+
+		if i == 0 && len(bytes.TrimSpace(b)) == 0 {
+			values[i] = map[string]string{}
+			continue
+		}
+
+		if files[i], err = internal.ReadSealedFile(bytes.NewReader(b)); err != nil {
+			return nil, err
+		}
+
+		if values[i], err = files[i].Open(id); err != nil {
+			return nil, err
+		}
+	}
+
+	merged, conflicts := mergeValues(values[0], values[1], values[2])
+	keys := uniqueKeys(append(files[1].RecipientKeys(), files[2].RecipientKeys()...))
+
+	f, err := internal.NewSealedFile(merged, keys, files[1], id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, f.Write(w)
+}
+
+func mergeValues(base, ours, theirs map[string]string) (map[string]string, []string) {
+	all := make(map[string]bool)
+
+	for _, m := range []map[string]string{base, ours, theirs} {
+		for k := range m {
+			all[k] = true
+		}
+	}
+
+	result := make(map[string]string, len(all))
+	conflicts := make([]string, 0)
+
+	for k := range all {
+		b, inBase := base[k]
+		o, inOurs := ours[k]
+		t, inTheirs := theirs[k]
+
+		same := func(v1 string, in1 bool, v2 string, in2 bool) bool {
+			return in1 == in2 && v1 == v2
+		}
+
+		switch {
+		case same(o, inOurs, t, inTheirs), same(t, inTheirs, b, inBase):
+			// both made the same change, or only we changed it
+			if inOurs {
+				result[k] = o
+			}
+
+		case same(o, inOurs, b, inBase):
+			// only they changed it
+			if inTheirs {
+				result[k] = t
+			}
+
+		default:
+			conflicts = append(conflicts, k)
+
+			if inOurs {
+				result[k] = o
+			} else {
+				result[k] = t
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+	return result, conflicts
+}
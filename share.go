@@ -0,0 +1,155 @@
+package envy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// identityLabel is the "realm" to which the user's keypair
+// is bound when it's sealed.
+const identityLabel = ".identity"
+
+// identity returns the user's keypair for sharing realms,
+// creating it the first time.
+func (e *Envy) identity() (*internal.Identity, error) {
+	var id internal.Identity
+
+	sd, err := e.db.GetIdentity()
+
+	if err == nil {
+		ud, err := e.sealer.UnsealFor(identityLabel, "x25519", sd)
+
+		if err != nil {
+			return nil, fmt.Errorf("unsealing identity: %w", err)
+		}
+
+		if err = json.Unmarshal([]byte(ud.Data), &id); err != nil {
+			return nil, err
+		}
+
+		return &id, nil
+	}
+
+	if !errors.Is(err, internal.ErrNotFound) {
+		return nil, err
+	}
+
+	nid, err := internal.NewIdentity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(nid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sd, err = e.sealer.SealFor(identityLabel, "x25519", internal.Unsealed{Data: string(b)}); err != nil {
+		return nil, err
+	}
+
+	if err = e.db.SetIdentity(sd); err != nil {
+		return nil, err
+	}
+
+	return nid, nil
+}
+
+// PublicKey returns the user's public key, which others use
+// to share realms with them.
+func (e *Envy) PublicKey() (string, error) {
+	id, err := e.identity()
+
+	if err != nil {
+		return "", err
+	}
+
+	return id.Recipient(), nil
+}
+
+// Share writes a realm encrypted so that only the recipients
+// (given as public keys from PublicKey) can receive it.
+func (e *Envy) Share(w io.Writer, realm string, recipients []string) error {
+	keys := make([][]byte, 0, len(recipients))
+
+	for _, r := range recipients {
+		k, err := internal.ParseRecipient(r)
+
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, k)
+	}
+
+	if err := e.checkReveal(realm); err != nil {
+		return err
+	}
+
+	m, err := e.fetchRaw(realm)
+
+	if err != nil {
+		return err
+	}
+
+	a := internal.NewArchive()
+	a.Realms[realm] = m
+
+	if err = a.WriteShared(w, keys); err != nil {
+		return err
+	}
+
+	return e.audit("share", realm)
+}
+
+// Receive imports a realm shared with this user, possibly under
+// a new name; it's merged or replaced as with Restore. Anyone may
+// send a share, so it must hold just the one realm, and if that's
+// a protected realm already here, it must be unlocked first.
+func (e *Envy) Receive(r io.Reader, rename string, opts RestoreOptions) ([]Change, error) {
+	id, err := e.identity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := internal.ReadShared(r, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a policy is the sender's, not ours to take
+
+	a.Policies = nil
+
+	if len(a.Realms) != 1 {
+		return nil, fmt.Errorf("share has %d realms, not 1", len(a.Realms))
+	}
+
+	var realm string
+
+	for k, v := range a.Realms {
+		realm = k
+
+		if rename != "" {
+			delete(a.Realms, k)
+			a.Realms[rename] = v
+			realm = rename
+		}
+	}
+
+	if !opts.DryRun {
+		if err = e.checkReveal(realm); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.restore(a, opts)
+}
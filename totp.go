@@ -0,0 +1,46 @@
+package envy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+var ErrNotTOTP = errors.New("not a TOTP value")
+
+// Code returns the current TOTP code (RFC 6238) for a TOTP
+// value, and how long it has left before the next one.
+func (v Value) Code(now time.Time) (string, time.Duration, error) {
+	if v.Type != TypeTOTP {
+		return "", 0, ErrNotTOTP
+	}
+
+	t, err := internal.ParseTOTP(v.Data)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	code, left := t.Code(now)
+	return code, left, nil
+}
+
+// TOTP returns the current code for a TOTP value, and how long
+// it has left; the seed itself is read (and audited) as by Get.
+func (e *Envy) TOTP(realm, key string) (string, time.Duration, error) {
+	v, err := e.GetValue(realm, key)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	code, left, err := v.Code(time.Now())
+
+	if err != nil {
+		return "", 0, fmt.Errorf("%s/%s: %w", realm, key, err)
+	}
+
+	return code, left, nil
+}
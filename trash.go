@@ -0,0 +1,317 @@
+package envy
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Dropped keys and purged realms go to the trash, from which they
+// may be restored until they expire. A realm goes along with its
+// data key (and so its policy), and its records are kept as they
+// were sealed; the whole item is sealed again so that its names
+// don't show.
+
+// TrashRetention is how long items stay in the trash.
+const TrashRetention = 30 * 24 * time.Hour
+
+// trashLabel is the "realm" to which trash items are bound.
+const trashLabel = ".trash"
+
+var ErrExists = errors.New("already exists")
+
+// TrashItem describes a dropped key or purged realm.
+type TrashItem struct {
+	Realm   string
+	Key     string   // empty for a purged realm
+	Keys    []string // the keys it holds
+	Dropped time.Time
+	Expires time.Time
+}
+
+type trashed struct {
+	Realm    string           `json:"realm"`
+	Key      string           `json:"key,omitempty"`
+	RealmKey *internal.Sealed `json:"realm_key,omitempty"`
+	Records  internal.Stored  `json:"records"`
+}
+
+// trashEntry is an item as loaded from the trash.
+type trashEntry struct {
+	id   string
+	item trashed
+	meta TrashItem
+}
+
+// trash moves the records (the key's, or else the whole realm's)
+// to the trash, removing them from the realm, and the realm itself
+// unless it's kept.
+func (e *Envy) trash(realm, key string, records internal.Stored, keep bool) error {
+	id, sd, err := e.trashItem(realm, key, records)
+
+	if err != nil {
+		return err
+	}
+
+	if keep && key == "" {
+		err = e.db.Clear(realm, id, sd, nil)
+	} else {
+		err = e.db.Trash(realm, key, id, sd)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.expireTrash()
+}
+
+// trashItem seals the records (and the realm's data key) as an
+// item for the trash, returning it with its ID.
+func (e *Envy) trashItem(realm, key string, records internal.Stored) (string, internal.Sealed, error) {
+	item := trashed{Realm: realm, Key: key, Records: records}
+
+	rk, err := e.db.GetRealmKey(realm)
+
+	if err == nil {
+		item.RealmKey = &rk
+	} else if !errors.Is(err, internal.ErrNotFound) {
+		return "", internal.Sealed{}, err
+	}
+
+	b, err := json.Marshal(item)
+
+	if err != nil {
+		return "", internal.Sealed{}, err
+	}
+
+	// IDs sort in the order items were dropped, and the
+	// random part keeps them apart if the clock is coarse
+
+	var r [4]byte
+
+	if _, err = rand.Read(r[:]); err != nil {
+		return "", internal.Sealed{}, err
+	}
+
+	now := time.Now()
+	id := fmt.Sprintf("%020d-%x", now.UnixNano(), r)
+	ud := internal.Unsealed{Data: string(b)}
+	ud.Meta.Expires = now.Add(TrashRetention).Unix()
+
+	sd, err := e.sealer.SealFor(trashLabel, id, ud)
+	return id, sd, err
+}
+
+// loadTrash returns the items in the trash, oldest first.
+func (e *Envy) loadTrash() ([]trashEntry, error) {
+	m, err := e.db.ListTrash()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]trashEntry, 0, len(m))
+
+	for id, sd := range m {
+		ud, err := e.sealer.UnsealFor(trashLabel, id, sd)
+
+		if err != nil {
+			return nil, fmt.Errorf("unsealing trash %s: %w", id, err)
+		}
+
+		t := trashEntry{id: id}
+
+		if err = json.Unmarshal([]byte(ud.Data), &t.item); err != nil {
+			return nil, fmt.Errorf("decoding trash %s: %w", id, err)
+		}
+
+		keys := make([]string, 0, len(t.item.Records))
+
+		for k := range t.item.Records {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		t.meta = TrashItem{
+			Realm:   t.item.Realm,
+			Key:     t.item.Key,
+			Keys:    keys,
+			Dropped: time.Unix(ud.Meta.Modified, 0),
+			Expires: ud.Meta.Expiry(),
+		}
+
+		result = append(result, t)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, nil
+}
+
+// expireTrash removes items whose retention has run out, which
+// it can tell without unsealing them.
+func (e *Envy) expireTrash() error {
+	m, err := e.db.ListTrash()
+
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0)
+
+	for id, sd := range m {
+		if md, err := sd.Metadata(); err == nil && time.Now().After(md.Expiry()) {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return e.db.DeleteTrash(ids...)
+}
+
+// Trash returns the items in the trash, oldest first.
+func (e *Envy) Trash() ([]TrashItem, error) {
+	if err := e.expireTrash(); err != nil {
+		return nil, err
+	}
+
+	entries, err := e.loadTrash()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TrashItem, 0, len(entries))
+
+	for _, t := range entries {
+		result = append(result, t.meta)
+	}
+
+	return result, nil
+}
+
+// RestoreTrash puts back the key (or if key is empty, the realm)
+// most recently dropped. It won't overwrite a key that's been set
+// since; a realm that no longer exists gets back its data key.
+func (e *Envy) RestoreTrash(realm, key string) error {
+	entries, err := e.loadTrash()
+
+	if err != nil {
+		return err
+	}
+
+	var found *trashEntry
+
+	for i := range entries {
+		if t := entries[i]; t.item.Realm == realm && t.item.Key == key {
+			found = &entries[i]
+		}
+	}
+
+	if found == nil {
+		name := realm
+
+		if key != "" {
+			name += "/" + key
+		}
+
+		return fmt.Errorf("trash %s: %w", name, internal.ErrNotFound)
+	}
+
+	current, err := e.db.ListKeys(realm)
+
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+
+	exists := err == nil
+
+	for _, k := range current {
+		if _, ok := found.item.Records[k]; ok {
+			return fmt.Errorf("%s/%s: %w", realm, k, ErrExists)
+		}
+	}
+
+	if !exists {
+		err = e.db.Untrash(found.id, realm, found.item.RealmKey, found.item.Records)
+	} else {
+		err = e.untrashInto(found, realm)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.audit("untrash", realm, found.meta.Keys...)
+}
+
+// untrashInto reseals the item's records for a realm that
+// exists (and may have a different key) and puts them back.
+func (e *Envy) untrashInto(t *trashEntry, realm string) error {
+	old := e.sealer
+
+	if t.item.RealmKey != nil {
+		rr, err := e.openRealmKey(realm, *t.item.RealmKey)
+
+		if err != nil {
+			return err
+		}
+
+		old = e.sealer.WithKey(rr.Key)
+	}
+
+	s, err := e.realmSealer(realm, true)
+
+	if err != nil {
+		return err
+	}
+
+	resealed := make(internal.Stored, len(t.item.Records))
+
+	for k, sd := range t.item.Records {
+		ud, err := old.UnsealFor(realm, k, sd)
+
+		if err != nil {
+			return fmt.Errorf("unsealing %s/%s: %w", realm, k, err)
+		}
+
+		// sealing keeps the original timestamp & expiry
+
+		if resealed[k], err = s.SealFor(realm, k, ud); err != nil {
+			return fmt.Errorf("sealing %s/%s: %w", realm, k, err)
+		}
+	}
+
+	return e.db.Untrash(t.id, realm, nil, resealed)
+}
+
+// EmptyTrash removes everything from the trash for good,
+// returning how many items there were.
+func (e *Envy) EmptyTrash() (int, error) {
+	m, err := e.db.ListTrash()
+
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(m))
+
+	for id := range m {
+		ids = append(ids, id)
+	}
+
+	if err = e.db.DeleteTrash(ids...); err != nil {
+		return 0, err
+	}
+
+	return len(ids), e.audit("empty", trashLabel)
+}
@@ -0,0 +1,207 @@
+package envy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// Value types, kept in each value's metadata; a value
+// without a type is a string.
+const (
+	TypeString = "string"
+	TypeBinary = "binary" // stored as base64
+	TypeJSON   = "json"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+	TypeFile   = "file" // binary, but exec passes it as a file
+	TypeTOTP   = "totp" // a seed, for which exec passes the code
+
+	// a string with references to other values, which is
+	// fetched as a string, with the references resolved
+	TypeTemplate = "template"
+)
+
+var (
+	ErrBadType  = errors.New("unknown value type")
+	ErrBadValue = errors.New("invalid value for its type")
+)
+
+// Value is a stored value along with its type.
+type Value struct {
+	Data string // base64 for binary & file values
+	Type string // empty for a string
+}
+
+// BinaryValue returns a value holding raw bytes.
+func BinaryValue(b []byte) Value {
+	return Value{Data: base64.StdEncoding.EncodeToString(b), Type: TypeBinary}
+}
+
+// normal returns the value with a plain string's type
+// empty, so that only other types are recorded.
+func (v Value) normal() Value {
+	if v.Type == TypeString {
+		v.Type = ""
+	}
+
+	return v
+}
+
+// check makes sure the data is valid for the type.
+func (v Value) check() error {
+	var err error
+
+	switch v.Type {
+	case "", TypeString:
+	case TypeBinary, TypeFile:
+		_, err = base64.StdEncoding.DecodeString(v.Data)
+	case TypeJSON:
+		if !json.Valid([]byte(v.Data)) {
+			err = errors.New("not JSON")
+		}
+	case TypeNumber:
+		_, err = strconv.ParseFloat(v.Data, 64)
+	case TypeBool:
+		_, err = strconv.ParseBool(v.Data)
+	case TypeTOTP:
+		_, err = internal.ParseTOTP(v.Data)
+	case TypeTemplate:
+		_, err = internal.Expand(v.Data, "-", func(string, string) (string, error) { return "", nil })
+	default:
+		return fmt.Errorf("%s: %w", v.Type, ErrBadType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w (%s)", v.Type, ErrBadValue, err)
+	}
+
+	return nil
+}
+
+// IsBinary reports whether the value is raw bytes.
+func (v Value) IsBinary() bool {
+	return v.Type == TypeBinary || v.Type == TypeFile
+}
+
+// Bytes returns the value itself, decoding binary values.
+func (v Value) Bytes() ([]byte, error) {
+	if v.IsBinary() {
+		return base64.StdEncoding.DecodeString(v.Data)
+	}
+
+	return []byte(v.Data), nil
+}
+
+// JSON returns the value as JSON of its type; binary
+// values are base64 strings.
+func (v Value) JSON() (json.RawMessage, error) {
+	switch v.Type {
+	case TypeJSON, TypeNumber, TypeBool:
+		var buf bytes.Buffer
+
+		if err := json.Compact(&buf, []byte(v.Data)); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return json.Marshal(v.Data)
+}
+
+// tagged reports whether the value's type can't be told from
+// its JSON, so that it's written along with its type.
+func (v Value) tagged() bool {
+	return v.IsBinary() || v.Type == TypeTOTP || v.Type == TypeTemplate
+}
+
+// typedJSON is how a tagged value is written in a document.
+type typedJSON struct {
+	Type  string `json:"$type"`
+	Value string `json:"$value"`
+}
+
+// ValueFromJSON returns a value typed by its JSON: a string,
+// number, or bool, with objects and arrays kept as JSON, except
+// an object with just "$type" and "$value" (see FetchDocument);
+// null is an empty string, as a key with no value in YAML.
+func ValueFromJSON(raw json.RawMessage) (Value, error) {
+	raw = bytes.TrimSpace(raw)
+
+	if len(raw) == 0 {
+		return Value{}, ErrBadValue
+	}
+
+	if v, ok := typedFromJSON(raw); ok {
+		return v, nil
+	}
+
+	switch raw[0] {
+	case '"':
+		var s string
+
+		err := json.Unmarshal(raw, &s)
+		return Value{Data: s}, err
+	case '{', '[':
+		var buf bytes.Buffer
+
+		err := json.Compact(&buf, raw)
+		return Value{Data: buf.String(), Type: TypeJSON}, err
+	case 't', 'f':
+		var b bool
+
+		err := json.Unmarshal(raw, &b)
+		return Value{Data: string(raw), Type: TypeBool}, err
+	case 'n':
+		if string(raw) == "null" {
+			return Value{}, nil
+		}
+	}
+
+	var n json.Number
+
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return Value{}, err
+	}
+
+	return Value{Data: n.String(), Type: TypeNumber}, nil
+}
+
+func typedFromJSON(raw json.RawMessage) (Value, bool) {
+	var m map[string]json.RawMessage
+	var tj typedJSON
+
+	if raw[0] != '{' || json.Unmarshal(raw, &m) != nil || len(m) != 2 {
+		return Value{}, false
+	}
+
+	if m[internal.TypeKey] == nil || m[internal.ValueKey] == nil || json.Unmarshal(raw, &tj) != nil {
+		return Value{}, false
+	}
+
+	return Value{Data: tj.Value, Type: tj.Type}, true
+}
+
+// ValuesAsJSON writes values as a JSON object, each as JSON
+// of its type.
+func ValuesAsJSON(m map[string]Value) (json.RawMessage, error) {
+	result := make(map[string]json.RawMessage, len(m))
+
+	for k, v := range m {
+		raw, err := v.JSON()
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+
+		result[k] = raw
+	}
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,227 @@
+package envy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/matt4biz/envy/internal"
+)
+
+// DefaultWatchInterval is how often Watch checks the DB.
+const DefaultWatchInterval = 2 * time.Second
+
+var ErrNoRealms = errors.New("no realms to watch")
+
+// EventKind says what happened to a key.
+type EventKind string
+
+const (
+	KeyAdded   EventKind = "added"
+	KeyChanged EventKind = "changed"
+	KeyRemoved EventKind = "removed"
+)
+
+// Metadata describes a stored value, without revealing it.
+type Metadata struct {
+	Size     int
+	Hash     string
+	Modified time.Time
+	Expires  time.Time // zero if it doesn't expire
+	Type     string    // empty for a string
+}
+
+// Event is a key that was added, changed, or removed, with
+// the new value's metadata (zero if it was removed).
+type Event struct {
+	Realm string
+	Key   string
+	Kind  EventKind
+	Meta  Metadata
+}
+
+// WatchOptions control how WatchWith checks for changes.
+type WatchOptions struct {
+	Interval time.Duration // default DefaultWatchInterval
+}
+
+// Watch is WatchWith, with the default options.
+func (e *Envy) Watch(ctx context.Context, realms ...string) (<-chan Event, error) {
+	return e.WatchWith(ctx, WatchOptions{}, realms...)
+}
+
+// WatchWith returns a channel of changes to the keys in the
+// realms (from this or any other process), which is closed when
+// ctx is done. The DB is only read when its file has changed, and
+// nothing is decrypted (or audited). While this Envy is suspended,
+// the watcher opens the DB itself, but only briefly; while it's
+// open, other processes can't change anything, of course.
+//
+// The channel isn't buffered, so changes are only looked for
+// again once those already found have been received.
+func (e *Envy) WatchWith(ctx context.Context, opts WatchOptions, realms ...string) (<-chan Event, error) {
+	if len(realms) == 0 {
+		return nil, ErrNoRealms
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+
+	stamp, err := e.Modified()
+
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := e.watchRead(ctx, realms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event)
+
+	go e.watch(ctx, opts.Interval, realms, snap, stamp, ch)
+
+	return ch, nil
+}
+
+// snapshot is the records of each realm as stored.
+type snapshot map[string]internal.Stored
+
+func (e *Envy) watch(ctx context.Context, interval time.Duration, realms []string, snap snapshot, stamp time.Time, ch chan<- Event) {
+	defer close(ch)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		// a change that's made while reading shows up
+		// as a change of time the next time round
+
+		m, err := e.Modified()
+
+		if err != nil || m.Equal(stamp) {
+			continue
+		}
+
+		next, err := e.watchRead(ctx, realms)
+
+		if err != nil {
+			continue // try again next time
+		}
+
+		for _, c := range snap.changes(next) {
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		snap, stamp = next, m
+	}
+}
+
+// watchRead reads the realms' records from the DB, opening
+// it just for that if this Envy is suspended.
+func (e *Envy) watchRead(ctx context.Context, realms []string) (snapshot, error) {
+	e.mu.Lock()
+
+	if !e.suspended {
+		defer e.mu.Unlock()
+		return readSnapshot(e.db, realms)
+	}
+
+	e.mu.Unlock()
+
+	db, _, err := openDB(ctx, e.dir, e.sealer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	return readSnapshot(db, realms)
+}
+
+func readSnapshot(db internal.DB, realms []string) (snapshot, error) {
+	result := make(snapshot, len(realms))
+
+	for _, r := range realms {
+		m, err := db.GetAllKeys(r)
+
+		if errors.Is(err, internal.ErrNotFound) {
+			m = internal.Stored{} // a missing realm has no keys
+		} else if err != nil {
+			return nil, fmt.Errorf("fetching %s: %w", r, err)
+		}
+
+		result[r] = m
+	}
+
+	return result, nil
+}
+
+// changes lists the differences from one snapshot to the
+// next, in order of realm and key.
+func (s snapshot) changes(next snapshot) []Event {
+	var result []Event
+
+	for r, m := range next {
+		old := s[r]
+
+		for k, sd := range m {
+			osd, ok := old[k]
+
+			switch {
+			case !ok:
+				result = append(result, Event{Realm: r, Key: k, Kind: KeyAdded, Meta: metadataOf(sd)})
+			case osd.Data != sd.Data || osd.Meta != sd.Meta:
+				result = append(result, Event{Realm: r, Key: k, Kind: KeyChanged, Meta: metadataOf(sd)})
+			}
+		}
+
+		for k := range old {
+			if _, ok := m[k]; !ok {
+				result = append(result, Event{Realm: r, Key: k, Kind: KeyRemoved})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Realm != result[j].Realm {
+			return result[i].Realm < result[j].Realm
+		}
+
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+func metadataOf(sd internal.Sealed) Metadata {
+	md, err := sd.Metadata()
+
+	if err != nil {
+		return Metadata{}
+	}
+
+	return Metadata{
+		Size:     md.Size,
+		Hash:     md.Hash,
+		Modified: time.Unix(md.Modified, 0),
+		Expires:  md.Expiry(),
+		Type:     md.Type,
+	}
+}